@@ -0,0 +1,72 @@
+// Command crashmail is an event listener mailing unexpected process exits.
+//
+//	[eventlistener:crashmail]
+//	command=crashmail -m ops@example.com -s localhost:25
+//	events=PROCESS_STATE_EXITED
+package main
+
+import (
+	"flag"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/listener/crashmail"
+	"log"
+	"os"
+	"strings"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var programs, recipients listFlag
+	flag.Var(&programs, "p", "report only this program or group; may be repeated")
+	flag.Var(&recipients, "m", "recipient address; may be repeated")
+	from := flag.String("f", "supervisor@localhost", "sender address")
+	server := flag.String("s", "localhost:25", "SMTP server host:port")
+	subject := flag.String("o", "crashmail", "subject prefix")
+	fatal := flag.Bool("fatal", false, "also report processes entering FATAL")
+	window := flag.Duration("w", 0, "collect crashes for this long before sending")
+	lines := flag.Int("n", 10, "number of stderr lines to include")
+	flag.Parse()
+
+	if len(recipients) == 0 {
+		log.Fatal("crashmail: at least one recipient (-m) is required")
+	}
+
+	n := &crashmail.Notifier{
+		Sender:    &crashmail.SMTPSender{Addr: *server},
+		From:      *from,
+		To:        recipients,
+		Subject:   *subject,
+		Programs:  programs,
+		TailLines: *lines,
+		Window:    *window,
+	}
+	if *fatal {
+		n.Events = []listener.EventType{listener.PROCESS_STATE_EXITED, listener.PROCESS_STATE_FATAL}
+	}
+
+	l := listener.NewListener(nil, nil, n)
+	if s, err := supervisor.Discover(); err == nil {
+		l.Supervisor = s
+	} else if err != supervisor.ErrNotSupervised {
+		log.Println("crashmail: process logs not available:", err)
+	}
+
+	err := l.Run()
+	if ferr := n.Flush(); ferr != nil {
+		log.Println(ferr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,46 @@
+// Command httpok is an event listener restarting a program that stops
+// responding to HTTP requests or TCP connections.
+//
+//	[eventlistener:httpok]
+//	command=httpok -p web:* -u http://localhost:8080/health -b ok -n 3
+//	events=TICK_60
+package main
+
+import (
+	"flag"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/listener/httpok"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	var check httpok.Check
+	flag.StringVar(&check.Program, "p", "", "program to restart, e.g. web:web_0 or web:*")
+	flag.StringVar(&check.URL, "u", "", "URL to probe; tcp://host:port checks for a connection only")
+	flag.DurationVar(&check.Timeout, "t", 10*time.Second, "probe timeout")
+	flag.IntVar(&check.Status, "c", 200, "expected HTTP status code")
+	flag.StringVar(&check.Body, "b", "", "string the response body must contain")
+	flag.IntVar(&check.Failures, "n", 1, "consecutive failures before restarting")
+	flag.StringVar(&check.Signal, "s", "", "signal sent before restarting, e.g. QUIT")
+	flag.DurationVar(&check.SignalDelay, "d", 0, "time to wait after sending the signal")
+	flag.Parse()
+
+	if check.Program == "" || check.URL == "" {
+		log.Fatal("httpok: -p and -u are required")
+	}
+
+	l := listener.NewListener(nil, nil, &httpok.Checker{Checks: []httpok.Check{check}})
+	//restarts may take long, don't hold up supervisord meanwhile
+	l.QueueSize = 1
+	s, err := supervisor.Discover()
+	if err != nil {
+		log.Fatal("httpok: ", err)
+	}
+	l.Supervisor = s
+	if err := l.Run(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+// Command listener-conformance runs an event listener executable the way
+// supervisord does, sends it a suite of events and reports violations of
+// the event listener protocol, such as output that is neither READY nor a
+// well-formed RESULT, or a missing READY.
+//
+//	listener-conformance -t 10s -- ./crashmail -m ops@example.com
+//
+// The suite defaults to one event of every type. A custom suite is a file
+// with one JSON object per line:
+//
+//	{"event": "TICK_60", "payload": "when:1700000040", "expect": "OK"}
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener/listenertest"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+func readSuite(path string) ([]listenertest.Step, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []listenertest.Step
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var step listenertest.Step
+		if err := json.Unmarshal(scanner.Bytes(), &step); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, scanner.Err()
+}
+
+func main() {
+	suitePath := flag.String("f", "", "suite file, one JSON step per line; all event types if empty")
+	timeout := flag.Duration("t", 5*time.Second, "time to wait for READY, RESULT and the listener to exit")
+	serverURL := flag.String("u", "http://127.0.0.1:9001", "SUPERVISOR_SERVER_URL passed to the listener")
+	verbose := flag.Bool("v", false, "print every delivery")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	suite := listenertest.DefaultSuite()
+	if *suitePath != "" {
+		var err error
+		if suite, err = readSuite(*suitePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(flag.Arg(0), flag.Args()[1:]...)
+	cmd.Stderr = os.Stderr
+	s, err := listenertest.Spawn(cmd, *serverURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.Timeout = *timeout
+
+	report := s.RunSuite(suite)
+	if *verbose {
+		for _, d := range report.Deliveries {
+			fmt.Printf("%-4s %s\n", string(d.Result), d.Header.String())
+		}
+	}
+	for _, u := range report.Unexpected {
+		fmt.Println("unexpected result:", u)
+	}
+	if report.Err != nil {
+		fmt.Println("protocol violation:", report.Err)
+	}
+	if err := s.Close(); err != nil {
+		fmt.Println("listener exit:", err)
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+	fmt.Printf("ok: %d events, %d deliveries\n", len(suite), len(report.Deliveries))
+}
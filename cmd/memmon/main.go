@@ -0,0 +1,77 @@
+// Command memmon is an event listener restarting processes that use too
+// much memory.
+//
+//	[eventlistener:memmon]
+//	command=memmon -p web=200MB -g workers=1GB -c 10m
+//	events=TICK_60
+package main
+
+import (
+	"flag"
+	"fmt"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/config"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/listener/memmon"
+	"log"
+	"os"
+	"strings"
+)
+
+// limitFlag collects name=size arguments.
+type limitFlag map[string]config.ByteSize
+
+func (l limitFlag) String() string {
+	return fmt.Sprint(map[string]config.ByteSize(l))
+}
+
+func (l limitFlag) Set(value string) error {
+	idx := strings.LastIndexByte(value, '=')
+	if idx < 0 {
+		return fmt.Errorf("expected name=size, got %q", value)
+	}
+
+	var size config.ByteSize
+	if err := size.UnmarshalText([]byte(value[idx+1:])); err != nil {
+		return err
+	}
+	l[value[:idx]] = size
+	return nil
+}
+
+func main() {
+	programs, groups := limitFlag{}, limitFlag{}
+	flag.Var(programs, "p", "limit for a process, name=size or group:name=size; may be repeated")
+	flag.Var(groups, "g", "limit for each process of a group, group=size; may be repeated")
+	anyLimit := flag.String("a", "", "limit for all other processes")
+	cooldown := flag.Duration("c", 0, "minimum time between restarts of a process")
+	dryRun := flag.Bool("n", false, "only report processes exceeding their limit")
+	flag.Parse()
+
+	m := &memmon.Monitor{
+		Programs: programs,
+		Groups:   groups,
+		Cooldown: *cooldown,
+		DryRun:   *dryRun,
+		Notify: func(r memmon.Restart) {
+			log.Printf("%s (pid %d) uses %d bytes, limit %d (dry run: %v, error: %v)", r.Name, r.Pid, r.RSS, r.Limit, r.DryRun, r.Err)
+		},
+	}
+	if *anyLimit != "" {
+		if err := m.Any.UnmarshalText([]byte(*anyLimit)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	l := listener.NewListener(nil, nil, m)
+	//restarts may take long, don't hold up supervisord meanwhile
+	l.QueueSize = 1
+	s, err := supervisor.Discover()
+	if err != nil {
+		log.Fatal("memmon: ", err)
+	}
+	l.Supervisor = s
+	if err := l.Run(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OptionChange is a single option that differs between two versions of a
+// process group. Process is empty for options of the group itself.
+type OptionChange struct {
+	Process string
+	Option  string
+	Old     string
+	New     string
+}
+
+func (o OptionChange) String() string {
+	name := o.Option
+	if o.Process != "" {
+		name = o.Process + "." + o.Option
+	}
+	return fmt.Sprintf("%s: %q -> %q", name, o.Old, o.New)
+}
+
+// GroupChange lists the differences of a group present in both
+// configurations.
+type GroupChange struct {
+	Group   string
+	Options []OptionChange
+}
+
+// ReloadDiff is the outcome supervisord's reloadConfig would report when
+// switching from one configuration to another.
+type ReloadDiff struct {
+	Added   []string
+	Changed []GroupChange
+	Removed []string
+}
+
+// Empty reports whether reloading would not affect any group.
+func (d *ReloadDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// Diff predicts which process groups supervisord reports as added, changed
+// or removed by reloadConfig when from is the active configuration and to
+// has been written to disk. Like supervisord, groups are compared after
+// expansion, so e must describe the host the configuration is deployed to.
+// Group names in each list are sorted.
+func Diff(from, to *Config, e *Evaluator) (*ReloadDiff, error) {
+	oldGroups, err := from.groupOptions(e)
+	if err != nil {
+		return nil, err
+	}
+	newGroups, err := to.groupOptions(e)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := new(ReloadDiff)
+	for _, name := range sortedGroupNames(newGroups) {
+		oldOptions, ok := oldGroups[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+
+		if changes := compareOptions(oldOptions, newGroups[name]); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, GroupChange{Group: name, Options: changes})
+		}
+	}
+	for _, name := range sortedGroupNames(oldGroups) {
+		if _, ok := newGroups[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	return diff, nil
+}
+
+type optionKey struct {
+	Process string
+	Option  string
+}
+
+func sortedGroupNames(groups map[string]map[optionKey]string) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func compareOptions(from, to map[optionKey]string) (changes []OptionChange) {
+	keys := make([]optionKey, 0, len(to))
+	for key := range to {
+		keys = append(keys, key)
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Process != keys[j].Process {
+			return keys[i].Process < keys[j].Process
+		}
+		return keys[i].Option < keys[j].Option
+	})
+
+	for _, key := range keys {
+		if from[key] != to[key] {
+			changes = append(changes, OptionChange{key.Process, key.Option, from[key], to[key]})
+		}
+	}
+	return
+}
+
+// groupOptions returns the effective options of every process, keyed by
+// group. Expanded values replace the raw ones where supervisord expands.
+func (c *Config) groupOptions(e *Evaluator) (map[string]map[optionKey]string, error) {
+	processes, err := c.Processes(e)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string]interface{})
+	for _, p := range c.Programs {
+		sections[p.Name] = p
+	}
+	for _, l := range c.EventListeners {
+		sections[l.Name] = l
+	}
+	for _, p := range c.FcgiPrograms {
+		sections[p.Name] = p
+	}
+
+	groups := make(map[string]map[optionKey]string)
+	for _, g := range c.Groups {
+		groups[g.Name] = map[optionKey]string{{"", "priority"}: fmt.Sprint(g.Priority)}
+	}
+
+	for _, proc := range processes {
+		options, err := encodeSection(sections[proc.ProgramName], nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", proc.ProgramName, err)
+		}
+
+		values := make(map[optionKey]string)
+		for _, opt := range options {
+			values[optionKey{proc.Name, opt.Key}] = opt.Value
+		}
+
+		expanded := map[string]string{
+			"process_name":   proc.Name,
+			"command":        proc.Command,
+			"directory":      proc.Directory,
+			"stdout_logfile": proc.StdoutLogfile,
+			"stderr_logfile": proc.StderrLogfile,
+			"serverurl":      proc.ServerURL,
+		}
+		for option, value := range expanded {
+			values[optionKey{proc.Name, option}] = value
+		}
+
+		env := make([]string, 0, len(proc.Environment))
+		for _, key := range sortedKeys(proc.Environment) {
+			env = append(env, key+"="+proc.Environment[key])
+		}
+		values[optionKey{proc.Name, "environment"}] = strings.Join(env, ",")
+
+		if groups[proc.Group] == nil {
+			groups[proc.Group] = make(map[optionKey]string)
+		}
+		for key, value := range values {
+			groups[proc.Group][key] = value
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from, err := Parse(strings.NewReader(`[program:web]
+command = web --port 80
+
+[program:cron]
+command = cron
+
+[program:worker]
+command = worker %(ENV_QUEUE)s
+
+[eventlistener:mail]
+command = crashmail
+events = PROCESS_STATE
+`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	to, err := Parse(strings.NewReader(`; web is unchanged apart from formatting and explicit defaults
+[program:web]
+command=web --port 80
+autostart = yes
+
+[program:worker]
+command = worker %(ENV_QUEUE)s
+numprocs = 2
+process_name = worker%(process_num)d
+
+[program:api]
+command = api
+
+[eventlistener:mail]
+command = crashmail
+events = PROCESS_STATE_EXITED
+`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	diff, err := Diff(from, to, &Evaluator{Environ: map[string]string{"QUEUE": "jobs"}})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !reflect.DeepEqual(diff.Added, []string{"api"}) {
+		t.Errorf("Unexpected added groups: %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"cron"}) {
+		t.Errorf("Unexpected removed groups: %v", diff.Removed)
+	}
+
+	if len(diff.Changed) != 2 || diff.Changed[0].Group != "mail" || diff.Changed[1].Group != "worker" {
+		t.Fatalf("Unexpected changed groups: %+v", diff.Changed)
+	}
+
+	expected := []OptionChange{{"mail", "events", "PROCESS_STATE", "PROCESS_STATE_EXITED"}}
+	if !reflect.DeepEqual(diff.Changed[0].Options, expected) {
+		t.Errorf("Unexpected changes for mail: %v", diff.Changed[0].Options)
+	}
+
+	var workerChanges []string
+	for _, change := range diff.Changed[1].Options {
+		workerChanges = append(workerChanges, change.Process+"."+change.Option)
+	}
+	if !strings.Contains(strings.Join(workerChanges, " "), "worker1.command") {
+		t.Errorf("Unexpected changes for worker: %v", workerChanges)
+	}
+}
+
+func TestDiffEnvironmentExpansion(t *testing.T) {
+	c, err := Parse(strings.NewReader("[program:worker]\ncommand = worker %(ENV_QUEUE)s\n"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	diff, err := Diff(c, c, &Evaluator{Environ: map[string]string{"QUEUE": "jobs"}})
+	if err != nil || !diff.Empty() {
+		t.Errorf("Expected empty diff, got %+v (err=%v)", diff, err)
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Editor modifies a configuration file while keeping comments, ordering
+// and the formatting of lines that are not touched.
+type Editor struct {
+	lines []string
+}
+
+type optionSpan struct {
+	key        string
+	start, end int
+}
+
+type sectionSpan struct {
+	name    string
+	header  int
+	end     int // one past the last header, option or continuation line
+	options []optionSpan
+}
+
+// NewEditor reads an ini file from r. The content must parse as a
+// configuration; see Parse.
+func NewEditor(r io.Reader) (*Editor, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = readIni("", bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	e := new(Editor)
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			e.lines = append(e.lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// OpenEditor reads the file at path into an Editor.
+func OpenEditor(path string) (*Editor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	e, err := NewEditor(f)
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = path
+	}
+	return e, err
+}
+
+func (e *Editor) scan() (sections []sectionSpan) {
+	var current *sectionSpan
+	inValue := false
+
+	for i, raw := range e.lines {
+		line := classifyLine(raw, inValue)
+
+		switch line.Kind {
+		case lineBlank:
+			inValue = false
+		case lineSection:
+			sections = append(sections, sectionSpan{name: line.Name, header: i, end: i + 1})
+			current = &sections[len(sections)-1]
+			inValue = false
+		case lineOption:
+			current.options = append(current.options, optionSpan{key: line.Name, start: i, end: i + 1})
+			current.end = i + 1
+			inValue = true
+		case lineContinuation:
+			current.options[len(current.options)-1].end = i + 1
+			current.end = i + 1
+		}
+	}
+
+	return
+}
+
+// section returns the last section with the given name. Options of
+// duplicate sections are merged when parsing, the later ones winning, so
+// that is where new options go.
+func (e *Editor) section(name string) *sectionSpan {
+	sections := e.scan()
+	for i := len(sections) - 1; i >= 0; i-- {
+		if sections[i].name == name {
+			return &sections[i]
+		}
+	}
+	return nil
+}
+
+// option returns the occurrence of an option that takes effect, the last
+// one in the last section with the given name that has it.
+func (e *Editor) option(section, key string) *optionSpan {
+	sections := e.scan()
+	for i := len(sections) - 1; i >= 0; i-- {
+		if sections[i].name != section {
+			continue
+		}
+		if opt := sections[i].option(key); opt != nil {
+			return opt
+		}
+	}
+	return nil
+}
+
+func (s *sectionSpan) option(key string) *optionSpan {
+	for i := len(s.options) - 1; i >= 0; i-- {
+		if s.options[i].key == key {
+			return &s.options[i]
+		}
+	}
+	return nil
+}
+
+func (e *Editor) splice(start, end int, lines ...string) {
+	if start > 0 && !strings.HasSuffix(e.lines[start-1], "\n") {
+		e.lines[start-1] += "\n"
+	}
+
+	tail := append([]string{}, e.lines[end:]...)
+	e.lines = append(append(e.lines[:start], lines...), tail...)
+}
+
+// Sections returns the section names in file order.
+func (e *Editor) Sections() []string {
+	var names []string
+	for _, s := range e.scan() {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// Get returns the raw value of an option.
+func (e *Editor) Get(section, key string) (string, bool) {
+	sections, err := readIni("", strings.NewReader(e.String()))
+	if err != nil {
+		return "", false
+	}
+
+	c := new(Config)
+	c.merge(sections)
+	if s := c.Section(section); s != nil {
+		return s.Get(strings.ToLower(key))
+	}
+	return "", false
+}
+
+// Set changes the value of an option, adding it after the last option of
+// the section if it does not exist yet. An existing option keeps its
+// spelling, spacing around the delimiter and inline comment. The value is
+// literal: every percent sign is escaped.
+func (e *Editor) Set(section, key, value string) error {
+	return e.set(section, key, value, false)
+}
+
+// SetExpression is like Set, but %(name)s expressions in value are kept;
+// other percent signs are escaped, as by GenerateProgramConfig.
+func (e *Editor) SetExpression(section, key, value string) error {
+	return e.set(section, key, value, true)
+}
+
+func (e *Editor) set(section, key, value string, expression bool) error {
+	key = strings.ToLower(key)
+	if !validKey(key) {
+		return fmt.Errorf("invalid option name %q", key)
+	}
+
+	rendered, err := renderValue(value, expression)
+	if err != nil {
+		return fmt.Errorf("[%s] %s: %v", section, key, err)
+	}
+
+	s := e.section(section)
+	if s == nil {
+		return fmt.Errorf("section [%s] does not exist", section)
+	}
+
+	opt := e.option(section, key)
+	if opt == nil {
+		e.splice(s.end, s.end, key+" = "+rendered+"\n")
+		return nil
+	}
+
+	line := e.lines[opt.start]
+	delim := strings.IndexAny(line, "=:")
+	prefixEnd := delim + 1
+	for prefixEnd < len(line) && (line[prefixEnd] == ' ' || line[prefixEnd] == '\t') {
+		prefixEnd++
+	}
+
+	comment := ""
+	body := strings.TrimRight(line[delim+1:], "\r\n")
+	if stripped := stripInlineComment(body); stripped != strings.TrimSpace(body) && !strings.Contains(rendered, "\n") {
+		comment = body[strings.Index(body, stripped)+len(stripped):]
+	}
+
+	e.splice(opt.start, opt.end, line[:prefixEnd]+rendered+comment+"\n")
+	return nil
+}
+
+// Remove deletes every occurrence of an option and its continuation lines.
+// It reports whether the option existed.
+func (e *Editor) Remove(section, key string) (removed bool) {
+	key = strings.ToLower(key)
+	for opt := e.option(section, key); opt != nil; opt = e.option(section, key) {
+		e.splice(opt.start, opt.end)
+		removed = true
+	}
+	return
+}
+
+// AddSection appends an empty section to the end of the file, separated by
+// a blank line.
+func (e *Editor) AddSection(name string) error {
+	if name == "" || strings.ContainsAny(name, "[]\r\n") {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	if e.section(name) != nil {
+		return fmt.Errorf("section [%s] already exists", name)
+	}
+
+	lines := []string{"[" + name + "]\n"}
+	if n := len(e.lines); n > 0 && strings.TrimSpace(e.lines[n-1]) != "" {
+		lines = append([]string{"\n"}, lines...)
+	}
+	e.splice(len(e.lines), len(e.lines), lines...)
+	return nil
+}
+
+// RemoveSection deletes every section with the given name together with the
+// comment lines directly above its header. Comments and blank lines after
+// its last option are kept, as they usually belong to the next section. It
+// reports whether the section existed.
+func (e *Editor) RemoveSection(name string) (removed bool) {
+	for s := e.section(name); s != nil; s = e.section(name) {
+		e.removeSection(s)
+		removed = true
+	}
+	return
+}
+
+func (e *Editor) removeSection(s *sectionSpan) {
+	start := s.header
+	for start > 0 && classifyLine(e.lines[start-1], false).Kind == lineComment {
+		start--
+	}
+
+	//avoid leaving a leading or doubled blank line behind
+	end := s.end
+	if start == 0 || strings.TrimSpace(e.lines[start-1]) == "" {
+		for end < len(e.lines) && strings.TrimSpace(e.lines[end]) == "" {
+			end++
+		}
+	}
+
+	e.splice(start, end)
+}
+
+// Config parses the current content of the editor.
+func (e *Editor) Config() (*Config, error) {
+	return Parse(strings.NewReader(e.String()))
+}
+
+func (e *Editor) String() string {
+	return strings.Join(e.lines, "")
+}
+
+func (e *Editor) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, e.String())
+	return int64(n), err
+}
+
+// Save writes the content to path, replacing the file atomically. An
+// existing file keeps its permissions.
+func (e *Editor) Save(path string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = f.Chmod(mode); err == nil {
+		if _, err = io.WriteString(f, e.String()); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editorInput = `; managed by hand, please keep the comments
+[supervisord]
+nodaemon=true ; run in foreground
+
+; the web frontend
+[program:web]
+command = web --port 80
+environment = A="1",
+  B="2"
+
+; workers below
+[program:worker]
+command = worker
+`
+
+func TestEditorRoundTrip(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if e.String() != editorInput {
+		t.Errorf("Unmodified editor changed the content:\n%s", e.String())
+	}
+
+	expected := []string{"supervisord", "program:web", "program:worker"}
+	if strings.Join(e.Sections(), ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected sections: %v", e.Sections())
+	}
+
+	if value, ok := e.Get("program:web", "environment"); !ok || value != "A=\"1\",\nB=\"2\"" {
+		t.Errorf("Unexpected value: %q", value)
+	}
+}
+
+func TestEditorModify(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = e.Set("supervisord", "nodaemon", "false"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.Set("program:web", "environment", `A="3"`); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.Set("program:web", "autostart", "false"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !e.Remove("program:worker", "command") {
+		t.Error("Expected command to be removed")
+	}
+	if err = e.AddSection("group:all"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.Set("group:all", "programs", "web,worker"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := `; managed by hand, please keep the comments
+[supervisord]
+nodaemon=false ; run in foreground
+
+; the web frontend
+[program:web]
+command = web --port 80
+environment = A="3"
+autostart = false
+
+; workers below
+[program:worker]
+
+[group:all]
+programs = web,worker
+`
+	if e.String() != expected {
+		t.Errorf("Unexpected content:\n%s", e.String())
+	}
+
+	c, err := e.Config()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(c.Groups) != 1 || c.Programs[0].AutoStart || c.Supervisord.NoDaemon {
+		t.Errorf("Edited content did not parse as expected: %+v", c)
+	}
+}
+
+func TestEditorPercent(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = e.Set("program:web", "command", "echo %(host)s"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.SetExpression("program:worker", "process_name", "%(program_name)s_%(process_num)02d"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.SetExpression("program:worker", "command", "date +%s"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if value, _ := e.Get("program:web", "command"); value != "echo %%(host)s" {
+		t.Errorf("Unexpected command: %q", value)
+	}
+	if value, _ := e.Get("program:worker", "process_name"); value != "%(program_name)s_%(process_num)02d" {
+		t.Errorf("Unexpected process_name: %q", value)
+	}
+	if value, _ := e.Get("program:worker", "command"); value != "date +%%s" {
+		t.Errorf("Unexpected command: %q", value)
+	}
+}
+
+func TestEditorRemoveSection(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !e.RemoveSection("program:web") {
+		t.Fatal("Expected section to be removed")
+	}
+	if e.RemoveSection("program:missing") {
+		t.Error("Removed a section that does not exist")
+	}
+
+	expected := `; managed by hand, please keep the comments
+[supervisord]
+nodaemon=true ; run in foreground
+
+; workers below
+[program:worker]
+command = worker
+`
+	if e.String() != expected {
+		t.Errorf("Unexpected content:\n%s", e.String())
+	}
+}
+
+func TestEditorDuplicateSections(t *testing.T) {
+	input := `[program:web]
+command = web
+autostart = false
+
+[program:web]
+priority = 10
+`
+	e, err := NewEditor(strings.NewReader(input))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = e.Set("program:web", "command", "web --port 80"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.Set("program:web", "priority", "20"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = e.Set("program:web", "user", "www"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if value, _ := e.Get("program:web", "command"); value != "web --port 80" {
+		t.Errorf("Unexpected command: %q", value)
+	}
+
+	expected := `[program:web]
+command = web --port 80
+autostart = false
+
+[program:web]
+priority = 20
+user = www
+`
+	if e.String() != expected {
+		t.Errorf("Unexpected content:\n%s", e.String())
+	}
+
+	if !e.RemoveSection("program:web") || len(e.Sections()) != 0 {
+		t.Errorf("Expected all occurrences to be removed: %v", e.Sections())
+	}
+}
+
+func TestEditorSave(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "supervisord.conf")
+	if err = os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Save(path); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != editorInput {
+		t.Errorf("Unexpected file content %q (err=%v)", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions to be kept: %v %v", info, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files, got %d entries", len(entries))
+	}
+}
+
+func TestEditorErrors(t *testing.T) {
+	e, err := NewEditor(strings.NewReader(editorInput))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = e.Set("program:missing", "command", "x"); err == nil {
+		t.Error("Expected error for missing section")
+	}
+	if err = e.Set("program:web", "command", "echo ; oops"); err == nil {
+		t.Error("Expected error for value that cannot be represented")
+	}
+	if err = e.AddSection("program:web"); err == nil {
+		t.Error("Expected error for duplicate section")
+	}
+
+	if _, err = NewEditor(strings.NewReader("garbage\n")); err == nil {
+		t.Error("Expected error for invalid input")
+	}
+}
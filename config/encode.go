@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// encodeSection turns the tagged fields of the struct pointed to by v into
+// options, in field order. If defaults is not nil, fields equal to the
+// corresponding field of defaults are left out.
+func encodeSection(v interface{}, defaults interface{}) (options []Option, err error) {
+	value := reflect.ValueOf(v).Elem()
+	var defaultValue reflect.Value
+	if defaults != nil {
+		defaultValue = reflect.ValueOf(defaults).Elem()
+	}
+
+	var walk func(v, d reflect.Value) error
+	walk = func(v, d reflect.Value) error {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("ini")
+
+			var fieldDefault reflect.Value
+			if d.IsValid() {
+				fieldDefault = d.Field(i)
+			}
+
+			if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+				if err := walk(v.Field(i), fieldDefault); err != nil {
+					return err
+				}
+				continue
+			}
+			if tag == "" || tag == "-" {
+				continue
+			}
+			if fieldDefault.IsValid() && reflect.DeepEqual(v.Field(i).Interface(), fieldDefault.Interface()) {
+				continue
+			}
+
+			formatted, ok, err := formatField(v.Field(i))
+			if err != nil {
+				return fmt.Errorf("%s: %v", tag, err)
+			}
+			if ok {
+				options = append(options, Option{Key: tag, Value: formatted})
+			}
+		}
+		return nil
+	}
+
+	err = walk(value, defaultValue)
+	return
+}
+
+// formatField is the inverse of setField. It reports false for nil
+// pointers and empty maps, which stand for options that are not set.
+func formatField(field reflect.Value) (string, bool, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return "", false, nil
+		}
+		return formatField(field.Elem())
+	}
+
+	if field.Type().Implements(textMarshalerType) {
+		text, err := field.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err == nil, err
+	}
+
+	if field.Type() == durationType {
+		return strconv.FormatInt(int64(field.Interface().(time.Duration)/time.Second), 10), true, nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true, nil
+	case reflect.Int:
+		return strconv.FormatInt(field.Int(), 10), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true, nil
+	case reflect.Slice:
+		items := make([]string, 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			item, ok, err := formatField(field.Index(i))
+			if err != nil {
+				return "", false, err
+			}
+			if strings.Contains(item, ",") {
+				return "", false, fmt.Errorf("list item %q contains a comma", item)
+			}
+			if ok {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ","), true, nil
+	case reflect.Map:
+		if field.Len() == 0 {
+			return "", false, nil
+		}
+		env, err := renderEnvironment(field.Interface().(map[string]string))
+		return env, err == nil, err
+	}
+
+	return "", false, fmt.Errorf("unsupported field type %s", field.Type())
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// expand performs the Python string interpolation supervisord applies to
+// option values: %(name)s and %(name)d style expressions are replaced with
+// entries from vars and %% becomes a literal %.
+func expand(value string, vars map[string]string) (string, error) {
+	if strings.IndexByte(value, '%') < 0 {
+		return value, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '%' {
+			out.WriteByte(c)
+			continue
+		}
+
+		if i+1 < len(value) && value[i+1] == '%' {
+			out.WriteByte('%')
+			i++
+			continue
+		}
+
+		if i+1 >= len(value) || value[i+1] != '(' {
+			return "", fmt.Errorf("bad format in '%s': '%%' must be followed by '%%' or '('", value)
+		}
+
+		end := strings.IndexByte(value[i:], ')')
+		if end < 0 {
+			return "", fmt.Errorf("bad format in '%s': unterminated expression", value)
+		}
+		name := value[i+2 : i+end]
+
+		//conversion flags and width, followed by the conversion type
+		j := i + end + 1
+		for j < len(value) && strings.IndexByte("0123456789-+ #.", value[j]) >= 0 {
+			j++
+		}
+		if j >= len(value) {
+			return "", fmt.Errorf("bad format in '%s': missing conversion type", value)
+		}
+
+		replacement, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("%%(%s)s is not a valid expansion in '%s'", name, value)
+		}
+
+		spec := value[i+end+1 : j]
+		switch value[j] {
+		case 's':
+			out.WriteString(fmt.Sprintf("%"+spec+"s", replacement))
+		case 'd', 'i':
+			n, err := strconv.Atoi(replacement)
+			if err != nil {
+				return "", fmt.Errorf("%%(%s)d requires a number, got '%s'", name, replacement)
+			}
+			out.WriteString(fmt.Sprintf("%"+spec+"d", n))
+		default:
+			return "", fmt.Errorf("bad format in '%s': unsupported conversion '%c'", value, value[j])
+		}
+		i = j
+	}
+
+	return out.String(), nil
+}
+
+// Process describes a single process supervisord creates for a program,
+// with all expressions expanded.
+type Process struct {
+	Name          string
+	Group         string
+	ProgramName   string
+	Num           int
+	Command       string
+	Directory     string
+	StdoutLogfile string
+	StderrLogfile string
+	ServerURL     string
+	Environment   map[string]string
+}
+
+// Evaluator expands program options the same way supervisord does when it
+// creates processes from a configuration.
+//
+// Expressions are expanded in each value after the file has been parsed, so
+// an expanded %(ENV_X)s is inserted literally: a newline, ';' or '#' in it
+// never starts a continuation line or a comment. In environment, the values
+// of the KEY="value" pairs are expanded after splitting them, whereas
+// supervisord expands the whole option first; an expansion containing a
+// comma or quotes can therefore yield different variables.
+type Evaluator struct {
+	// Here is the value of %(here)s, the directory of the configuration
+	// file defining the program.
+	Here string
+
+	// HostNodeName is the value of %(host_node_name)s. If empty, the local
+	// host name is used.
+	HostNodeName string
+
+	// Environ provides the values for %(ENV_X)s, keyed by X. If nil, the
+	// environment of the current process is used.
+	Environ map[string]string
+}
+
+func (e *Evaluator) expansions(p *ProgramConfig, group string) map[string]string {
+	vars := make(map[string]string)
+	if e.Environ != nil {
+		for key, value := range e.Environ {
+			vars["ENV_"+key] = value
+		}
+	} else {
+		vars = environmentExpansions()
+	}
+
+	host := e.HostNodeName
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	vars["here"] = e.Here
+	vars["host_node_name"] = host
+	vars["program_name"] = p.Name
+	vars["group_name"] = group
+	vars["numprocs"] = strconv.Itoa(p.NumProcs)
+	return vars
+}
+
+// expandLogfile expands a logfile path; AUTO is kept since supervisord picks
+// a random name in childlogdir, and NONE becomes the empty string.
+func expandLogfile(path string, vars map[string]string) (string, error) {
+	switch strings.ToUpper(path) {
+	case "AUTO":
+		return "AUTO", nil
+	case "NONE", "":
+		return "", nil
+	}
+	return expand(path, vars)
+}
+
+// Processes returns the processes supervisord would create for p as a
+// member of group. If group is empty, the program forms its own group.
+func (e *Evaluator) Processes(p *ProgramConfig, group string) ([]Process, error) {
+	if group == "" {
+		group = p.Name
+	}
+	if p.NumProcs < 1 {
+		return nil, fmt.Errorf("program:%s: numprocs must be at least 1", p.Name)
+	}
+	if p.NumProcs > 1 && !strings.Contains(p.ProcessName, "%(process_num)") {
+		return nil, fmt.Errorf("program:%s: process_name must include %%(process_num)s when numprocs > 1", p.Name)
+	}
+
+	vars := e.expansions(p, group)
+	processes := make([]Process, 0, p.NumProcs)
+	seen := make(map[string]bool)
+
+	for num := p.NumProcsStart; num < p.NumProcsStart+p.NumProcs; num++ {
+		vars["process_num"] = strconv.Itoa(num)
+
+		proc := Process{Group: group, ProgramName: p.Name, Num: num}
+		var err error
+		fail := func(option string, err error) error {
+			return fmt.Errorf("program:%s: %s: %v", p.Name, option, err)
+		}
+
+		if proc.Name, err = expand(p.ProcessName, vars); err != nil {
+			return nil, fail("process_name", err)
+		}
+		if seen[proc.Name] {
+			return nil, fail("process_name", fmt.Errorf("duplicate process name '%s'", proc.Name))
+		}
+		seen[proc.Name] = true
+
+		if proc.Command, err = expand(p.Command, vars); err != nil {
+			return nil, fail("command", err)
+		}
+		if proc.Directory, err = expand(p.Directory, vars); err != nil {
+			return nil, fail("directory", err)
+		}
+		if proc.ServerURL, err = expand(p.ServerURL, vars); err != nil {
+			return nil, fail("serverurl", err)
+		}
+		if proc.StdoutLogfile, err = expandLogfile(p.StdoutLogfile, vars); err != nil {
+			return nil, fail("stdout_logfile", err)
+		}
+		if proc.StderrLogfile, err = expandLogfile(p.StderrLogfile, vars); err != nil {
+			return nil, fail("stderr_logfile", err)
+		}
+		if p.RedirectStderr {
+			proc.StderrLogfile = ""
+		}
+
+		proc.Environment = make(map[string]string, len(p.Environment))
+		for key, value := range p.Environment {
+			if proc.Environment[key], err = expand(value, vars); err != nil {
+				return nil, fail("environment", err)
+			}
+		}
+
+		processes = append(processes, proc)
+	}
+
+	return processes, nil
+}
+
+// Processes returns every process supervisord would create from c,
+// including those of event listeners and FastCGI programs. %(here)s is the
+// directory of the file each section was read from. If e is nil, a zero
+// Evaluator is used.
+func (c *Config) Processes(e *Evaluator) ([]Process, error) {
+	if e == nil {
+		e = new(Evaluator)
+	}
+
+	groups := make(map[string]string)
+	for _, g := range c.Groups {
+		for _, program := range g.Programs {
+			groups[program] = g.Name
+		}
+	}
+
+	var processes []Process
+	seen := make(map[string]bool)
+	add := func(section string, p *ProgramConfig) error {
+		evaluator := *e
+		if s := c.Section(section); s != nil && s.File != "" {
+			evaluator.Here, _ = filepath.Abs(filepath.Dir(s.File))
+		} else if evaluator.Here == "" {
+			evaluator.Here, _ = os.Getwd()
+		}
+
+		procs, err := evaluator.Processes(p, groups[p.Name])
+		if err != nil {
+			return err
+		}
+
+		for _, proc := range procs {
+			fullName := proc.Group + ":" + proc.Name
+			if seen[fullName] {
+				return fmt.Errorf("%s: duplicate process %s", section, fullName)
+			}
+			seen[fullName] = true
+		}
+		processes = append(processes, procs...)
+		return nil
+	}
+
+	for _, p := range c.Programs {
+		if err := add("program:"+p.Name, p); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range c.EventListeners {
+		if err := add("eventlistener:"+l.Name, &l.ProgramConfig); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range c.FcgiPrograms {
+		if err := add("fcgi-program:"+p.Name, &p.ProgramConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return processes, nil
+}
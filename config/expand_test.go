@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluatorProcesses(t *testing.T) {
+	p := NewProgramConfig("worker", "worker --id %(process_num)d --host %(host_node_name)s")
+	p.ProcessName = "%(program_name)s_%(process_num)02d"
+	p.NumProcs = 2
+	p.NumProcsStart = 1
+	p.Directory = "%(here)s"
+	p.StdoutLogfile = "/var/log/%(group_name)s/%(process_num)d.log"
+	p.StderrLogfile = "NONE"
+	p.Environment = map[string]string{"HOME": "%(ENV_HOME)s", "TOTAL": "%(numprocs)d"}
+
+	e := &Evaluator{Here: "/etc/supervisor", HostNodeName: "node1", Environ: map[string]string{"HOME": "/root"}}
+	procs, err := e.Processes(p, "pool")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(procs) != 2 {
+		t.Fatalf("Expected 2 processes, got %d", len(procs))
+	}
+
+	proc := procs[1]
+	if proc.Name != "worker_02" || proc.Group != "pool" || proc.Num != 2 || proc.Command != "worker --id 2 --host node1" ||
+		proc.Directory != "/etc/supervisor" || proc.StdoutLogfile != "/var/log/pool/2.log" || proc.StderrLogfile != "" {
+		t.Errorf("Unexpected process: %+v", proc)
+	}
+	if proc.Environment["HOME"] != "/root" || proc.Environment["TOTAL"] != "2" {
+		t.Errorf("Unexpected environment: %v", proc.Environment)
+	}
+}
+
+func TestEvaluatorErrors(t *testing.T) {
+	e := &Evaluator{Environ: map[string]string{}}
+
+	p := NewProgramConfig("worker", "worker")
+	p.NumProcs = 2
+	if _, err := e.Processes(p, ""); err == nil || !strings.Contains(err.Error(), "process_num") {
+		t.Errorf("Expected process_num error, got %v", err)
+	}
+
+	p = NewProgramConfig("worker", "worker %(ENV_MISSING)s")
+	if _, err := e.Processes(p, ""); err == nil || !strings.Contains(err.Error(), "command") {
+		t.Errorf("Expected command error, got %v", err)
+	}
+}
+
+func TestConfigProcesses(t *testing.T) {
+	c, err := Parse(strings.NewReader(`[program:a]
+command = a %(group_name)s
+
+[program:b]
+command = b %(group_name)s
+
+[group:ab]
+programs = a
+
+[eventlistener:l]
+command = l
+events = TICK_5
+`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	procs, err := c.Processes(&Evaluator{Environ: map[string]string{}})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var names []string
+	for _, proc := range procs {
+		names = append(names, proc.Group+":"+proc.Name+"="+proc.Command)
+	}
+	if strings.Join(names, " ") != "ab:a=a ab b:b=b b l:l=l" {
+		t.Errorf("Unexpected processes: %v", names)
+	}
+}
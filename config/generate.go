@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"text/template"
+	"strings"
 )
 
 //define program options
@@ -34,23 +36,161 @@ const (
 	ServerURL             = "serverurl"
 )
 
-const (
-	programTemplateText string = `[program:{{ .Name }}]
-{{ range $name, $value := .Options }}{{ $name }} = {{ $value }}
-{{ end }}`
-)
+// GenerateProgramConfig writes a [program:x] section with the given options
+// in alphabetical order. Option names must be lower case. Values are
+// written as supervisord reads them: a %(name)s style expression is kept
+// and any other percent sign is escaped as %%, so "date +%s" is written as
+// date +%%s. Text that looks like an expression but is meant literally must
+// be passed through Escape.
+func GenerateProgramConfig(name string, options map[string]string, out io.Writer) error {
+	keys := sortedKeys(options)
+	ordered := make([]Option, len(keys))
+	for i, key := range keys {
+		ordered[i] = Option{Key: key, Value: options[key]}
+	}
 
-var (
-	programTemplate = template.Must(template.New("supervisorProgram").Parse(programTemplateText))
-)
+	return renderSection(out, "program:"+name, ordered)
+}
 
-func GenerateProgramConfig(name string, options map[string]string, out io.Writer) error {
-	data := struct {
-		Name    string
-		Options map[string]string
-	}{
-		name, options,
+// generateStruct writes the options of v that differ from defaults.
+func generateStruct(out io.Writer, name string, v, defaults interface{}) error {
+	options, err := encodeSection(v, defaults)
+	if err != nil {
+		return fmt.Errorf("[%s] %v", name, err)
+	}
+	return renderSection(out, name, options)
+}
+
+func (s *UnixHTTPServer) Generate(out io.Writer) error {
+	if s.File == "" {
+		return errors.New("unix_http_server: file must not be empty")
+	}
+	return generateStruct(out, "unix_http_server", s, NewUnixHTTPServer(""))
+}
+
+func (s *InetHTTPServer) Generate(out io.Writer) error {
+	if s.Port == "" {
+		return errors.New("inet_http_server: port must not be empty")
+	}
+	return generateStruct(out, "inet_http_server", s, new(InetHTTPServer))
+}
+
+func (s *Supervisord) Generate(out io.Writer) error {
+	return generateStruct(out, "supervisord", s, NewSupervisord())
+}
+
+// Generate writes the section; an empty ServerURL stands for
+// DefaultServerURL, as it does when parsing.
+func (s *Supervisorctl) Generate(out io.Writer) error {
+	c := *s
+	if c.ServerURL == "" {
+		c.ServerURL = DefaultServerURL
+	}
+	return generateStruct(out, "supervisorctl", &c, NewSupervisorctl(DefaultServerURL))
+}
+
+func (i *Include) Generate(out io.Writer) error {
+	if len(i.Files) == 0 {
+		return errors.New("include: files must not be empty")
+	}
+	return renderSection(out, "include", []Option{{Key: "files", Value: strings.Join(i.Files, " ")}})
+}
+
+func (g *Group) Generate(out io.Writer) error {
+	if g.Name == "" || len(g.Programs) == 0 {
+		return errors.New("group: name and programs must not be empty")
+	}
+	return generateStruct(out, "group:"+g.Name, g, NewGroup(g.Name))
+}
+
+func (l *EventListener) Generate(out io.Writer) error {
+	if err := l.ProgramConfig.Validate(); err != nil {
+		return err
+	}
+	if len(l.Events) == 0 {
+		return fmt.Errorf("eventlistener:%s: events must not be empty", l.Name)
+	}
+	if l.BufferSize < 1 {
+		return fmt.Errorf("eventlistener:%s: buffer_size must be at least 1", l.Name)
+	}
+	if l.StdoutCaptureMaxBytes != 0 {
+		return fmt.Errorf("eventlistener:%s: stdout_capture_maxbytes is not supported for event listeners", l.Name)
+	}
+	return generateStruct(out, "eventlistener:"+l.Name, l, NewEventListener(l.Name, ""))
+}
+
+func (p *FcgiProgram) Generate(out io.Writer) error {
+	if err := p.ProgramConfig.Validate(); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(p.Socket, "unix://") && !strings.HasPrefix(p.Socket, "tcp://") {
+		return fmt.Errorf("fcgi-program:%s: socket must start with unix:// or tcp://", p.Name)
+	}
+	return generateStruct(out, "fcgi-program:"+p.Name, p, NewFcgiProgram(p.Name, "", ""))
+}
+
+func (r *RPCInterface) Generate(out io.Writer) error {
+	if r.Name == "" || r.Factory == "" {
+		return errors.New("rpcinterface: name and supervisor.rpcinterface_factory must not be empty")
+	}
+
+	options := []Option{{Key: "supervisor.rpcinterface_factory", Value: r.Factory}}
+	for _, key := range sortedKeys(r.Options) {
+		options = append(options, Option{Key: key, Value: r.Options[key]})
+	}
+	return renderSection(out, "rpcinterface:"+r.Name, options)
+}
+
+type generator interface {
+	Generate(out io.Writer) error
+}
+
+// Generate writes every section of c to out, separated by blank lines. Raw
+// Sections are not written; only the typed fields are.
+func (c *Config) Generate(out io.Writer) error {
+	var sections []generator
+
+	if c.UnixHTTPServer != nil {
+		sections = append(sections, c.UnixHTTPServer)
+	}
+	if c.InetHTTPServer != nil {
+		sections = append(sections, c.InetHTTPServer)
+	}
+	if c.Supervisord != nil {
+		sections = append(sections, c.Supervisord)
+	}
+	for _, r := range c.RPCInterfaces {
+		sections = append(sections, r)
+	}
+	if c.Supervisorctl != nil {
+		sections = append(sections, c.Supervisorctl)
+	}
+	for _, p := range c.Programs {
+		sections = append(sections, p)
+	}
+	for _, g := range c.Groups {
+		sections = append(sections, g)
+	}
+	for _, l := range c.EventListeners {
+		sections = append(sections, l)
+	}
+	for _, p := range c.FcgiPrograms {
+		sections = append(sections, p)
+	}
+	if c.Include != nil {
+		sections = append(sections, c.Include)
+	}
+
+	for i, section := range sections {
+		if i > 0 {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := section.Generate(out); err != nil {
+			return err
+		}
 	}
 
-	return programTemplate.Execute(out, data)
+	return nil
 }
@@ -26,3 +26,114 @@ priority = 5
 		t.Fail()
 	}
 }
+
+func TestGenerateConfig(t *testing.T) {
+	expected := `[unix_http_server]
+file = /tmp/supervisor.sock
+
+[supervisord]
+nodaemon = true
+
+[rpcinterface:supervisor]
+supervisor.rpcinterface_factory = supervisor.rpcinterface:make_main_rpcinterface
+
+[supervisorctl]
+serverurl = unix:///tmp/supervisor.sock
+
+[program:cat]
+command = /bin/cat
+
+[group:all]
+programs = cat,web
+
+[eventlistener:crashmail]
+command = crashmail
+events = PROCESS_STATE_EXITED,TICK_60
+result_handler = custom:handler
+
+[fcgi-program:web]
+command = /usr/bin/web
+socket = unix:///tmp/web.sock
+socket_owner = www
+
+[include]
+files = conf.d/*.conf extra.conf
+`
+	sd := NewSupervisord()
+	sd.NoDaemon = true
+
+	listener := NewEventListener("crashmail", "crashmail", "PROCESS_STATE_EXITED", "TICK_60")
+	listener.ResultHandler = "custom:handler"
+
+	web := NewFcgiProgram("web", "/usr/bin/web", "unix:///tmp/web.sock")
+	web.SocketOwner = "www"
+
+	c := &Config{
+		UnixHTTPServer: NewUnixHTTPServer("/tmp/supervisor.sock"),
+		Supervisord:    sd,
+		RPCInterfaces: []*RPCInterface{
+			{Name: "supervisor", Factory: "supervisor.rpcinterface:make_main_rpcinterface"},
+		},
+		Supervisorctl:  NewSupervisorctl("unix:///tmp/supervisor.sock"),
+		Programs:       []*ProgramConfig{NewProgramConfig("cat", "/bin/cat")},
+		Groups:         []*Group{NewGroup("all", "cat", "web")},
+		EventListeners: []*EventListener{listener},
+		FcgiPrograms:   []*FcgiProgram{web},
+		Include:        &Include{Files: []string{"conf.d/*.conf", "extra.conf"}},
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := c.Generate(buffer); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if buffer.String() != expected {
+		t.Errorf("Return value does not match expected value:\n%s", buffer.String())
+	}
+
+	parsed, err := Parse(buffer)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(parsed.Sections) != 9 || parsed.EventListeners[0].ResultHandler != "custom:handler" ||
+		parsed.FcgiPrograms[0].SocketOwner != "www" || !parsed.Supervisord.NoDaemon {
+		t.Errorf("Generated config did not parse back: %+v", parsed)
+	}
+}
+
+func TestGenerateSectionErrors(t *testing.T) {
+	listener := NewEventListener("l", "listener")
+	if err := listener.Generate(new(bytes.Buffer)); err == nil {
+		t.Error("Expected error for event listener without events")
+	}
+
+	web := NewFcgiProgram("web", "/usr/bin/web", "/tmp/web.sock")
+	if err := web.Generate(new(bytes.Buffer)); err == nil {
+		t.Error("Expected error for fcgi-program with invalid socket")
+	}
+
+	if err := NewGroup("empty").Generate(new(bytes.Buffer)); err == nil {
+		t.Error("Expected error for group without programs")
+	}
+}
+
+func TestGenerateSupervisorctlDefaults(t *testing.T) {
+	for _, ctl := range []*Supervisorctl{new(Supervisorctl), NewSupervisorctl(DefaultServerURL)} {
+		buffer := new(bytes.Buffer)
+		if err := (&Config{Supervisorctl: ctl}).Generate(buffer); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if buffer.String() != "[supervisorctl]\n" {
+			t.Errorf("Unexpected output for %+v:\n%s", ctl, buffer.String())
+		}
+
+		parsed, err := Parse(buffer)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if parsed.Supervisorctl.ServerURL != DefaultServerURL {
+			t.Errorf("Expected default serverurl, got %q", parsed.Supervisorctl.ServerURL)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// supervisord reads its configuration with Python's RawConfigParser
+// (inline comments enabled, strict mode off). The functions in this file
+// implement the subset of that dialect supervisord relies on.
+
+type lineKind int
+
+const (
+	lineBlank lineKind = iota
+	lineComment
+	lineSection
+	lineOption
+	lineContinuation
+	lineInvalid
+)
+
+var sectionPattern = regexp.MustCompile(`^\[([^\]]+)\]`)
+
+// iniLine is the classification of a single physical line.
+type iniLine struct {
+	Kind  lineKind
+	Name  string // section name or lower-cased option key
+	Value string // option value or continuation text, inline comment removed
+}
+
+// stripInlineComment removes a trailing ';' or '#' comment. Like Python's
+// configparser the comment character must be preceded by whitespace.
+func stripInlineComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if (value[i] == ';' || value[i] == '#') && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+func isComment(trimmed string) bool {
+	return strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#")
+}
+
+// classifyLine determines what a line is. inValue reports whether an option
+// value is currently open, in which case indented lines continue it.
+func classifyLine(raw string, inValue bool) iniLine {
+	line := strings.TrimRight(raw, "\r\n")
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case trimmed == "":
+		return iniLine{Kind: lineBlank}
+	case isComment(trimmed):
+		return iniLine{Kind: lineComment}
+	case inValue && (line[0] == ' ' || line[0] == '\t'):
+		return iniLine{Kind: lineContinuation, Value: stripInlineComment(trimmed)}
+	}
+
+	if m := sectionPattern.FindStringSubmatch(line); m != nil {
+		return iniLine{Kind: lineSection, Name: m[1]}
+	}
+
+	idx := strings.IndexAny(line, "=:")
+	if idx <= 0 || strings.TrimSpace(line[:idx]) == "" {
+		return iniLine{Kind: lineInvalid}
+	}
+
+	return iniLine{
+		Kind:  lineOption,
+		Name:  strings.ToLower(strings.TrimSpace(line[:idx])),
+		Value: stripInlineComment(line[idx+1:]),
+	}
+}
+
+// Option is a single key/value pair read from a section. Value has inline
+// comments removed and continuation lines joined with '\n'; no expansion is
+// performed.
+type Option struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Section is a raw ini section as found in a file.
+type Section struct {
+	Name    string
+	File    string
+	Line    int
+	Options []Option
+}
+
+// Get returns the value of the last occurrence of key in the section.
+func (s *Section) Get(key string) (string, bool) {
+	for i := len(s.Options) - 1; i >= 0; i-- {
+		if s.Options[i].Key == key {
+			return s.Options[i].Value, true
+		}
+	}
+	return "", false
+}
+
+func (s *Section) set(opt Option) {
+	for i := range s.Options {
+		if s.Options[i].Key == opt.Key {
+			s.Options[i] = opt
+			return
+		}
+	}
+	s.Options = append(s.Options, opt)
+}
+
+// readIni splits r into sections. Options appearing more than once keep
+// their last value.
+func readIni(file string, r io.Reader) (sections []*Section, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var current *Section
+	var option *Option
+	lineNo := 0
+
+	flush := func() {
+		if option != nil {
+			current.set(*option)
+			option = nil
+		}
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := classifyLine(scanner.Text(), option != nil)
+
+		switch line.Kind {
+		case lineBlank:
+			flush()
+		case lineComment:
+		case lineContinuation:
+			if option.Value == "" {
+				option.Value = line.Value
+			} else {
+				option.Value += "\n" + line.Value
+			}
+		case lineSection:
+			flush()
+			current = &Section{Name: line.Name, File: file, Line: lineNo}
+			sections = append(sections, current)
+		case lineOption:
+			flush()
+			if current == nil {
+				return nil, &ParseError{file, lineNo, "option outside of a section"}
+			}
+			option = &Option{Key: line.Name, Value: line.Value, Line: lineNo}
+		default:
+			return nil, &ParseError{file, lineNo, "expected section header or option"}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	flush()
+	return
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseError describes a problem at a specific line of a configuration file.
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d: %s", file, e.Line, e.Msg)
+}
+
+// Config is a parsed supervisord configuration.
+type Config struct {
+	// Sections holds every section in order of first appearance. Sections
+	// repeated in the same or an included file are merged, later options
+	// replacing earlier ones, as supervisord does.
+	Sections []*Section
+
+	Supervisord    *Supervisord
+	UnixHTTPServer *UnixHTTPServer
+	InetHTTPServer *InetHTTPServer
+	Supervisorctl  *Supervisorctl
+	Include        *Include
+	Programs       []*ProgramConfig
+	Groups         []*Group
+	EventListeners []*EventListener
+	FcgiPrograms   []*FcgiProgram
+	RPCInterfaces  []*RPCInterface
+}
+
+// Section returns the raw section called name, or nil.
+func (c *Config) Section(name string) *Section {
+	for _, s := range c.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (c *Config) merge(sections []*Section) {
+	for _, s := range sections {
+		if existing := c.Section(s.Name); existing != nil {
+			for _, opt := range s.Options {
+				existing.set(opt)
+			}
+		} else {
+			c.Sections = append(c.Sections, s)
+		}
+	}
+}
+
+// Parse reads a configuration from r. [include] sections are recorded but
+// not followed; use ParseFile to read included files as well.
+func Parse(r io.Reader) (*Config, error) {
+	sections, err := readIni("", r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	c.merge(sections)
+	return c, c.decode()
+}
+
+// ParseFile reads the configuration file at path together with the files
+// matched by its [include] section. Relative patterns are resolved against
+// the directory of path, and %(here)s and %(ENV_X)s are expanded in them.
+// As with supervisord, [include] sections in included files are ignored.
+func ParseFile(path string) (*Config, error) {
+	sections, err := readIniFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	c.merge(sections)
+
+	if include := c.Section("include"); include != nil {
+		files, ok := include.Get("files")
+		if !ok {
+			return nil, &ParseError{include.File, include.Line, "[include] section has no files option"}
+		}
+
+		here, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+
+		vars := environmentExpansions()
+		vars["here"] = here
+		if files, err = expand(files, vars); err != nil {
+			return nil, &ParseError{include.File, include.Line, err.Error()}
+		}
+
+		for _, pattern := range strings.Fields(files) {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(here, pattern)
+			}
+
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, &ParseError{include.File, include.Line, err.Error()}
+			}
+			sort.Strings(matches)
+
+			for _, match := range matches {
+				included, err := readIniFile(match)
+				if err != nil {
+					return nil, err
+				}
+				c.merge(included)
+			}
+		}
+	}
+
+	return c, c.decode()
+}
+
+func readIniFile(path string) ([]*Section, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readIni(path, f)
+}
+
+// environmentExpansions returns the ENV_X variables supervisord makes
+// available to expressions.
+func environmentExpansions() map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if idx := strings.IndexByte(kv, '='); idx > 0 {
+			vars["ENV_"+kv[:idx]] = kv[idx+1:]
+		}
+	}
+	return vars
+}
+
+func (c *Config) decode() error {
+	for _, s := range c.Sections {
+		kind, name := s.Name, ""
+		if idx := strings.IndexByte(s.Name, ':'); idx >= 0 {
+			kind, name = s.Name[:idx], s.Name[idx+1:]
+			if name == "" {
+				return &ParseError{s.File, s.Line, fmt.Sprintf("section [%s] has no name", s.Name)}
+			}
+		}
+
+		var err error
+		switch kind {
+		case "supervisord":
+			c.Supervisord = NewSupervisord()
+			err = decodeSection(s, c.Supervisord)
+		case "unix_http_server":
+			c.UnixHTTPServer = NewUnixHTTPServer("")
+			err = decodeSection(s, c.UnixHTTPServer)
+		case "inet_http_server":
+			c.InetHTTPServer = new(InetHTTPServer)
+			err = decodeSection(s, c.InetHTTPServer)
+		case "supervisorctl":
+			c.Supervisorctl = NewSupervisorctl(DefaultServerURL)
+			err = decodeSection(s, c.Supervisorctl)
+		case "include":
+			files, _ := s.Get("files")
+			c.Include = &Include{Files: strings.Fields(files)}
+		case "program":
+			p := NewProgramConfig(name, "")
+			err = decodeSection(s, p)
+			c.Programs = append(c.Programs, p)
+		case "group":
+			g := NewGroup(name)
+			err = decodeSection(s, g)
+			c.Groups = append(c.Groups, g)
+		case "eventlistener":
+			l := NewEventListener(name, "")
+			err = decodeSection(s, l)
+			c.EventListeners = append(c.EventListeners, l)
+		case "fcgi-program":
+			p := NewFcgiProgram(name, "", "")
+			err = decodeSection(s, p)
+			c.FcgiPrograms = append(c.FcgiPrograms, p)
+		case "rpcinterface":
+			r := &RPCInterface{Name: name, Options: make(map[string]string)}
+			err = decodeSection(s, r)
+			for _, opt := range s.Options {
+				if opt.Key != "supervisor.rpcinterface_factory" {
+					r.Options[opt.Key] = opt.Value
+				}
+			}
+			c.RPCInterfaces = append(c.RPCInterfaces, r)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// structFields maps ini tags to the fields of v, descending into embedded
+// structs.
+func structFields(v reflect.Value, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("ini")
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			structFields(v.Field(i), fields)
+		} else if tag != "" && tag != "-" {
+			fields[tag] = v.Field(i)
+		}
+	}
+}
+
+// decodeSection copies the options of s into the struct pointed to by out.
+// Options without a matching field are ignored, like supervisord does.
+func decodeSection(s *Section, out interface{}) error {
+	fields := make(map[string]reflect.Value)
+	structFields(reflect.ValueOf(out).Elem(), fields)
+
+	for _, opt := range s.Options {
+		field, ok := fields[opt.Key]
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, opt.Value); err != nil {
+			return &ParseError{s.File, opt.Line, fmt.Sprintf("[%s] %s: %v", s.Name, opt.Key, err)}
+		}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if field.Type() == durationType {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid number of seconds '%s'", value)
+		}
+		field.SetInt(int64(time.Duration(n) * time.Second))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer '%s'", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		list := parseList(value)
+		slice := reflect.MakeSlice(field.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := setField(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	case reflect.Map:
+		env, err := parseEnvironment(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(env))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
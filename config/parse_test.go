@@ -0,0 +1,101 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	c, err := ParseFile("testdata/supervisord.conf")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if c.UnixHTTPServer == nil || c.UnixHTTPServer.File != "/tmp/supervisor.sock" || c.UnixHTTPServer.Chmod != 0770 {
+		t.Errorf("Unexpected [unix_http_server]: %+v", c.UnixHTTPServer)
+	}
+
+	if c.InetHTTPServer == nil || c.InetHTTPServer.Port != "127.0.0.1:9001" || c.InetHTTPServer.Password != "123" {
+		t.Errorf("Unexpected [inet_http_server]: %+v", c.InetHTTPServer)
+	}
+
+	sd := c.Supervisord
+	if sd == nil || sd.LogfileMaxBytes != 10*MB || !sd.NoDaemon || sd.LogfileBackups != 10 || sd.Logfile != "%(here)s/supervisord.log" {
+		t.Errorf("Unexpected [supervisord]: %+v", sd)
+	}
+	if !reflect.DeepEqual(sd.Environment, map[string]string{"A": "1", "B": "two words"}) {
+		t.Errorf("Unexpected environment: %v", sd.Environment)
+	}
+
+	if len(c.RPCInterfaces) != 1 || c.RPCInterfaces[0].Factory != "supervisor.rpcinterface:make_main_rpcinterface" ||
+		c.RPCInterfaces[0].Options["retries"] != "1" {
+		t.Errorf("Unexpected [rpcinterface:x]: %+v", c.RPCInterfaces)
+	}
+
+	if len(c.Programs) != 1 {
+		t.Fatalf("Expected 1 program, got %d", len(c.Programs))
+	}
+	p := c.Programs[0]
+	if p.Name != "cat" || p.Command != "/bin/cat\n-n" || p.AutoRestart != AutoRestartTrue || p.Priority != 5 ||
+		p.StdoutLogfileMaxBytes != KB || p.UMask == nil || *p.UMask != 022 || !p.AutoStart {
+		t.Errorf("Unexpected [program:cat]: %+v", p)
+	}
+	if !reflect.DeepEqual(p.ExitCodes, []int{0, 2}) {
+		t.Errorf("Unexpected exitcodes: %v", p.ExitCodes)
+	}
+
+	if len(c.EventListeners) != 1 || c.EventListeners[0].BufferSize != 20 || c.EventListeners[0].Priority != -1 ||
+		!reflect.DeepEqual(c.EventListeners[0].Events, []string{"PROCESS_STATE_EXITED", "TICK_60"}) {
+		t.Errorf("Unexpected [eventlistener:x]: %+v", c.EventListeners)
+	}
+
+	if len(c.FcgiPrograms) != 1 || c.FcgiPrograms[0].Socket != "tcp://localhost:9002" || c.FcgiPrograms[0].SocketMode != 0660 {
+		t.Errorf("Unexpected [fcgi-program:x]: %+v", c.FcgiPrograms)
+	}
+
+	if len(c.Groups) != 1 || c.Groups[0].Priority != 10 || !reflect.DeepEqual(c.Groups[0].Programs, []string{"cat", "web"}) {
+		t.Errorf("Unexpected [group:x]: %+v", c.Groups)
+	}
+
+	if s := c.Section("eventlistener:crashmail"); s == nil || !strings.HasSuffix(s.File, "testdata/conf.d/listeners.conf") || s.Line != 1 {
+		t.Errorf("Unexpected section location: %+v", s)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"command = foo\n", "<input>:1: option outside of a section"},
+		{"[program:a]\n\njunk\n", "<input>:3: expected section header or option"},
+		{"[program:a]\nnumprocs = two\n", "<input>:2: [program:a] numprocs: invalid integer 'two'"},
+		{"[program:a]\nautostart = maybe\n", "<input>:2: [program:a] autostart: invalid boolean 'maybe'"},
+		{"[program:]\n", "<input>:1: section [program:] has no name"},
+		{"[supervisord]\nenvironment = A=1,B\n", "<input>:2: [supervisord] environment: unexpected end of key/value pairs in 'A=1,B'"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Parse(%q): expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"program_name": "cat", "process_num": "3"}
+
+	result, err := expand("%(program_name)s_%(process_num)02d 100%%", vars)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if result != "cat_03 100%" {
+		t.Errorf("Unexpected expansion: %s", result)
+	}
+
+	if _, err = expand("%(missing)s", vars); err == nil {
+		t.Error("Expected error for unknown expansion")
+	}
+}
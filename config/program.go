@@ -0,0 +1,274 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestartPolicy is the value of a program's autorestart option.
+type RestartPolicy int
+
+const (
+	AutoRestartUnexpected RestartPolicy = iota
+	AutoRestartTrue
+	AutoRestartFalse
+)
+
+func (a RestartPolicy) String() string {
+	switch a {
+	case AutoRestartUnexpected:
+		return "unexpected"
+	case AutoRestartTrue:
+		return "true"
+	case AutoRestartFalse:
+		return "false"
+	}
+	return fmt.Sprintf("RestartPolicy(%d)", int(a))
+}
+
+func (a RestartPolicy) MarshalText() ([]byte, error) {
+	if a < AutoRestartUnexpected || a > AutoRestartFalse {
+		return nil, fmt.Errorf("invalid autorestart value %d", int(a))
+	}
+	return []byte(a.String()), nil
+}
+
+func (a *RestartPolicy) UnmarshalText(text []byte) error {
+	value := strings.ToLower(strings.TrimSpace(string(text)))
+	if value == "unexpected" {
+		*a = AutoRestartUnexpected
+		return nil
+	}
+
+	b, err := parseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid autorestart value '%s'", text)
+	}
+
+	if b {
+		*a = AutoRestartTrue
+	} else {
+		*a = AutoRestartFalse
+	}
+	return nil
+}
+
+// Signal is a signal name as accepted by stopsignal, without the SIG prefix.
+type Signal string
+
+const (
+	SIGTERM Signal = "TERM"
+	SIGHUP  Signal = "HUP"
+	SIGINT  Signal = "INT"
+	SIGQUIT Signal = "QUIT"
+	SIGKILL Signal = "KILL"
+	SIGUSR1 Signal = "USR1"
+	SIGUSR2 Signal = "USR2"
+)
+
+var signalNames = map[Signal]bool{
+	"HUP": true, "INT": true, "QUIT": true, "ILL": true, "TRAP": true, "ABRT": true,
+	"BUS": true, "FPE": true, "KILL": true, "USR1": true, "SEGV": true, "USR2": true,
+	"PIPE": true, "ALRM": true, "TERM": true, "CHLD": true, "CONT": true, "STOP": true,
+	"TSTP": true, "TTIN": true, "TTOU": true, "URG": true, "XCPU": true, "XFSZ": true,
+	"VTALRM": true, "PROF": true, "WINCH": true, "IO": true, "PWR": true, "SYS": true,
+}
+
+func (s Signal) valid() bool {
+	if n, err := strconv.Atoi(string(s)); err == nil {
+		return n > 0 && n < 65
+	}
+	return signalNames[s]
+}
+
+func (s Signal) MarshalText() ([]byte, error) {
+	if !s.valid() {
+		return nil, fmt.Errorf("invalid signal '%s'", string(s))
+	}
+	return []byte(s), nil
+}
+
+func (s *Signal) UnmarshalText(text []byte) error {
+	sig := Signal(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(string(text))), "SIG"))
+	if !sig.valid() {
+		return fmt.Errorf("invalid signal '%s'", text)
+	}
+
+	*s = sig
+	return nil
+}
+
+// ProgramConfig is a [program:x] section. Use NewProgramConfig to get a
+// value populated with supervisord's defaults; options left at their
+// default are omitted when the section is generated.
+//
+// String fields such as Command hold the value as supervisord reads it,
+// with %(name)s expressions unexpanded. When generating, a percent sign
+// that does not start an expression is escaped, so Command may be
+// "date +%s"; a literal "%(host)s" must be written with Escape.
+type ProgramConfig struct {
+	Name                  string            `ini:"-"`
+	Command               string            `ini:"command"`
+	ProcessName           string            `ini:"process_name"`
+	NumProcs              int               `ini:"numprocs"`
+	NumProcsStart         int               `ini:"numprocs_start"`
+	Priority              int               `ini:"priority"`
+	AutoStart             bool              `ini:"autostart"`
+	StartSecs             time.Duration     `ini:"startsecs"`
+	StartRetries          int               `ini:"startretries"`
+	AutoRestart           RestartPolicy     `ini:"autorestart"`
+	ExitCodes             []int             `ini:"exitcodes"`
+	StopSignal            Signal            `ini:"stopsignal"`
+	StopWaitSecs          time.Duration     `ini:"stopwaitsecs"`
+	StopAsGroup           bool              `ini:"stopasgroup"`
+	KillAsGroup           bool              `ini:"killasgroup"`
+	User                  string            `ini:"user"`
+	RedirectStderr        bool              `ini:"redirect_stderr"`
+	StdoutLogfile         string            `ini:"stdout_logfile"`
+	StdoutLogfileMaxBytes ByteSize          `ini:"stdout_logfile_maxbytes"`
+	StdoutLogfileBackups  int               `ini:"stdout_logfile_backups"`
+	StdoutCaptureMaxBytes ByteSize          `ini:"stdout_capture_maxbytes"`
+	StdoutEventsEnabled   bool              `ini:"stdout_events_enabled"`
+	StdoutSyslog          bool              `ini:"stdout_syslog"`
+	StderrLogfile         string            `ini:"stderr_logfile"`
+	StderrLogfileMaxBytes ByteSize          `ini:"stderr_logfile_maxbytes"`
+	StderrLogfileBackups  int               `ini:"stderr_logfile_backups"`
+	StderrCaptureMaxBytes ByteSize          `ini:"stderr_capture_maxbytes"`
+	StderrEventsEnabled   bool              `ini:"stderr_events_enabled"`
+	StderrSyslog          bool              `ini:"stderr_syslog"`
+	Environment           map[string]string `ini:"environment"`
+	Directory             string            `ini:"directory"`
+	UMask                 *Octal            `ini:"umask"`
+	ServerURL             string            `ini:"serverurl"`
+}
+
+// NewProgramConfig returns a program section with supervisord's defaults.
+func NewProgramConfig(name, command string) *ProgramConfig {
+	return &ProgramConfig{
+		Name:                  name,
+		Command:               command,
+		ProcessName:           "%(program_name)s",
+		NumProcs:              1,
+		Priority:              999,
+		AutoStart:             true,
+		StartSecs:             time.Second,
+		StartRetries:          3,
+		AutoRestart:           AutoRestartUnexpected,
+		ExitCodes:             []int{0},
+		StopSignal:            SIGTERM,
+		StopWaitSecs:          10 * time.Second,
+		StdoutLogfile:         "AUTO",
+		StdoutLogfileMaxBytes: 50 * MB,
+		StdoutLogfileBackups:  10,
+		StderrLogfile:         "AUTO",
+		StderrLogfileMaxBytes: 50 * MB,
+		StderrLogfileBackups:  10,
+	}
+}
+
+// Validate checks the configuration for values supervisord would reject.
+func (p *ProgramConfig) Validate() error {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if p.Name == "" {
+		fail("name must not be empty")
+	} else if strings.ContainsAny(p.Name, ":[]\n") {
+		fail("name '%s' contains invalid characters", p.Name)
+	}
+	if strings.TrimSpace(p.Command) == "" {
+		fail("command must not be empty")
+	}
+	if p.NumProcs < 1 {
+		fail("numprocs must be at least 1")
+	} else if p.NumProcs > 1 && !strings.Contains(p.ProcessName, "%(process_num)") {
+		fail("process_name must include %%(process_num)s when numprocs > 1")
+	}
+	if p.NumProcsStart < 0 {
+		fail("numprocs_start must not be negative")
+	}
+	if p.StartRetries < 0 {
+		fail("startretries must not be negative")
+	}
+
+	if p.StartSecs < 0 || p.StartSecs%time.Second != 0 {
+		fail("startsecs must be a non-negative whole number of seconds")
+	}
+	if p.StopWaitSecs < 0 || p.StopWaitSecs%time.Second != 0 {
+		fail("stopwaitsecs must be a non-negative whole number of seconds")
+	}
+
+	if _, err := p.AutoRestart.MarshalText(); err != nil {
+		fail("%v", err)
+	}
+	if len(p.ExitCodes) == 0 {
+		fail("exitcodes must not be empty")
+	}
+	for _, code := range p.ExitCodes {
+		if code < 0 || code > 255 {
+			fail("exit code %d out of range", code)
+		}
+	}
+	if !p.StopSignal.valid() {
+		fail("invalid stopsignal '%s'", string(p.StopSignal))
+	}
+
+	if p.StdoutLogfileMaxBytes < 0 || p.StdoutCaptureMaxBytes < 0 ||
+		p.StderrLogfileMaxBytes < 0 || p.StderrCaptureMaxBytes < 0 {
+		fail("byte sizes must not be negative")
+	}
+	if p.StdoutLogfileBackups < 0 || p.StderrLogfileBackups < 0 {
+		fail("logfile backups must not be negative")
+	}
+	if p.RedirectStderr && p.StderrLogfile != "AUTO" && p.StderrLogfile != "" {
+		fail("stderr_logfile cannot be set when redirect_stderr is true")
+	}
+
+	for _, key := range sortedKeys(p.Environment) {
+		if key == "" || strings.ContainsAny(key, "=, \t\n\"'") {
+			fail("invalid environment variable name '%s'", key)
+		}
+	}
+	if p.UMask != nil && *p.UMask > 0777 {
+		fail("umask %o out of range", uint32(*p.UMask))
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid program config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Options returns the options that differ from supervisord's defaults,
+// suitable for GenerateProgramConfig.
+func (p *ProgramConfig) Options() (map[string]string, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	encoded, err := encodeSection(p, NewProgramConfig(p.Name, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]string)
+	for _, opt := range encoded {
+		options[opt.Key] = opt.Value
+	}
+	return options, nil
+}
+
+// Generate validates the program and writes it as a [program:x] section.
+func (p *ProgramConfig) Generate(out io.Writer) error {
+	options, err := p.Options()
+	if err != nil {
+		return err
+	}
+	return GenerateProgramConfig(p.Name, options, out)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgramConfigGenerate(t *testing.T) {
+	expected := `[program:web]
+autorestart = true
+command = /usr/bin/web --port 80
+environment = HOME="/srv",PORT="80"
+startsecs = 5
+stdout_logfile_maxbytes = 1MB
+stopsignal = QUIT
+umask = 022
+`
+	umask := Octal(022)
+	p := NewProgramConfig("web", "/usr/bin/web --port 80")
+	p.AutoRestart = AutoRestartTrue
+	p.StartSecs = 5 * time.Second
+	p.StopSignal = SIGQUIT
+	p.StdoutLogfileMaxBytes = MB
+	p.Environment = map[string]string{"PORT": "80", "HOME": "/srv"}
+	p.UMask = &umask
+
+	buffer := new(bytes.Buffer)
+	if err := p.Generate(buffer); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if buffer.String() != expected {
+		t.Errorf("Return value does not match expected value:\n%s", buffer.String())
+	}
+
+	c, err := Parse(buffer)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(c.Programs) != 1 {
+		t.Fatalf("Expected 1 program, got %d", len(c.Programs))
+	}
+
+	parsed := c.Programs[0]
+	if parsed.AutoRestart != AutoRestartTrue || parsed.StartSecs != 5*time.Second || parsed.StopSignal != SIGQUIT ||
+		parsed.StdoutLogfileMaxBytes != MB || parsed.Environment["HOME"] != "/srv" || *parsed.UMask != 022 {
+		t.Errorf("Generated config did not parse back: %+v", parsed)
+	}
+}
+
+func TestProgramConfigValidate(t *testing.T) {
+	tests := []struct {
+		modify   func(p *ProgramConfig)
+		expected string
+	}{
+		{func(p *ProgramConfig) { p.Command = "" }, "command must not be empty"},
+		{func(p *ProgramConfig) { p.NumProcs = 2 }, "process_name must include %(process_num)s"},
+		{func(p *ProgramConfig) { p.AutoRestart = RestartPolicy(7) }, "invalid autorestart value 7"},
+		{func(p *ProgramConfig) { p.StopSignal = "TERMINATE" }, "invalid stopsignal 'TERMINATE'"},
+		{func(p *ProgramConfig) { p.ExitCodes = []int{0, 256} }, "exit code 256 out of range"},
+		{func(p *ProgramConfig) { p.StopWaitSecs = 1500 * time.Millisecond }, "stopwaitsecs must be"},
+		{func(p *ProgramConfig) { p.Environment = map[string]string{"A B": "1"} }, "invalid environment variable name 'A B'"},
+	}
+
+	for _, test := range tests {
+		p := NewProgramConfig("test", "cat")
+		test.modify(p)
+
+		err := p.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected error containing %q, got %v", test.expected, err)
+		}
+	}
+
+	if err := NewProgramConfig("test", "cat").Validate(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestParseProgramTypes(t *testing.T) {
+	c, err := Parse(strings.NewReader("[program:a]\ncommand = a\nstopsignal = sigint\nautorestart = false\nstopwaitsecs = 3\n"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	p := c.Programs[0]
+	if p.StopSignal != SIGINT || p.AutoRestart != AutoRestartFalse || p.StopWaitSecs != 3*time.Second {
+		t.Errorf("Unexpected program: %+v", p)
+	}
+
+	if _, err = Parse(strings.NewReader("[program:a]\nautorestart = maybe\n")); err == nil {
+		t.Error("Expected error for invalid autorestart")
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Values in the configuration structures are stored the way supervisord
+// reads them: %(name)s expressions are kept and a literal percent sign is
+// written as %%. Sections are rendered from such expressions, escaping
+// percent signs that do not start a valid expression; other values are
+// literal text whose percent signs are all escaped. The functions in
+// this file turn values into ini text that parses to exactly the same
+// value, or report why that is not possible.
+
+// Escape returns value with every percent sign doubled, so that supervisord
+// reads it literally instead of as the start of an expression.
+func Escape(value string) string {
+	return strings.Replace(value, "%", "%%", -1)
+}
+
+// expressionLength returns the length of the %%, %(name)s or %(name)02d
+// expression at the start of value, or 0 if there is none.
+func expressionLength(value string) int {
+	if strings.HasPrefix(value, "%%") {
+		return 2
+	}
+	if !strings.HasPrefix(value, "%(") {
+		return 0
+	}
+
+	end := strings.IndexByte(value, ')')
+	if end < 3 || strings.ContainsAny(value[2:end], "%(\n") {
+		return 0
+	}
+
+	j := end + 1
+	for j < len(value) && strings.IndexByte("0123456789-+ #.", value[j]) >= 0 {
+		j++
+	}
+	if j < len(value) && strings.IndexByte("sdi", value[j]) >= 0 {
+		return j + 1
+	}
+	return 0
+}
+
+// escapeLonePercent doubles every percent sign that does not start a valid
+// expression, which supervisord would otherwise reject.
+func escapeLonePercent(value string) string {
+	if strings.IndexByte(value, '%') < 0 {
+		return value
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(value); {
+		if value[i] != '%' {
+			out.WriteByte(value[i])
+			i++
+		} else if n := expressionLength(value[i:]); n > 0 {
+			out.WriteString(value[i : i+n])
+			i += n
+		} else {
+			out.WriteString("%%")
+			i++
+		}
+	}
+	return out.String()
+}
+
+// renderValue returns the ini representation of value. If expression is
+// false, value is literal and every percent sign is escaped; otherwise only
+// those not starting a valid expression are. Lines after the first become
+// indented continuation lines.
+func renderValue(value string, expression bool) (string, error) {
+	if expression {
+		value = escapeLonePercent(value)
+	} else {
+		value = Escape(value)
+	}
+
+	lines := strings.Split(value, "\n")
+	for _, line := range lines {
+		switch {
+		case line != strings.TrimSpace(line):
+			return "", fmt.Errorf("value %q has leading or trailing whitespace", value)
+		case line == "" && len(lines) > 1:
+			return "", fmt.Errorf("value %q contains an empty line", value)
+		case strings.Contains(line, " ;") || strings.Contains(line, " #") ||
+			strings.Contains(line, "\t;") || strings.Contains(line, "\t#"):
+			return "", fmt.Errorf("value %q would be read as an inline comment", value)
+		case strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+			return "", fmt.Errorf("value %q has a line that would be read as a comment", value)
+		}
+	}
+
+	return strings.Join(lines, "\n    "), nil
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// renderEnvironment encodes env as KEY="value" pairs sorted by key,
+// choosing single quotes for values that contain a double quote.
+func renderEnvironment(env map[string]string) (string, error) {
+	keys := sortedKeys(env)
+	pairs := make([]string, len(keys))
+
+	for i, key := range keys {
+		for j := 0; j < len(key); j++ {
+			if !isEnvWordChar(key[j]) {
+				return "", fmt.Errorf("environment variable name %q cannot be represented", key)
+			}
+		}
+
+		value := env[key]
+		quote := `"`
+		if strings.Contains(value, `"`) {
+			quote = `'`
+		}
+
+		switch {
+		case strings.Contains(value, `"`) && strings.Contains(value, `'`):
+			return "", fmt.Errorf("environment value %q contains both quote characters", value)
+		case strings.Trim(value, `'"`) != value:
+			return "", fmt.Errorf("environment value %q must not start or end with a quote", value)
+		case strings.ContainsAny(value, "\r\n"):
+			return "", fmt.Errorf("environment value %q must not contain a newline", value)
+		}
+
+		pairs[i] = key + "=" + quote + value + quote
+	}
+
+	return strings.Join(pairs, ","), nil
+}
+
+// renderSection writes a section header followed by options in the given
+// order. Option values are expressions.
+func renderSection(out io.Writer, name string, options []Option) error {
+	if name == "" || strings.ContainsAny(name, "[]\r\n") {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+
+	var buffer strings.Builder
+	buffer.WriteString("[" + name + "]\n")
+
+	for _, opt := range options {
+		if !validKey(opt.Key) {
+			return fmt.Errorf("[%s]: invalid option name %q", name, opt.Key)
+		}
+
+		value, err := renderValue(opt.Value, true)
+		if err != nil {
+			return fmt.Errorf("[%s] %s: %v", name, opt.Key, err)
+		}
+
+		buffer.WriteString(opt.Key + " = " + value + "\n")
+	}
+
+	_, err := io.WriteString(out, buffer.String())
+	return err
+}
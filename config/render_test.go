@@ -0,0 +1,120 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderRoundTrip(t *testing.T) {
+	values := []string{
+		`echo "Hello world"`,
+		`date +%s`,
+		`100% done`,
+		`curl http://%(host)s/`,
+		"first line\nsecond line",
+		`a#b;c`,
+		``,
+	}
+
+	for _, value := range values {
+		buffer := new(bytes.Buffer)
+		if err := GenerateProgramConfig("test", map[string]string{Command: Escape(value)}, buffer); err != nil {
+			t.Errorf("Unexpected error for %q: %v", value, err)
+			continue
+		}
+
+		c, err := Parse(buffer)
+		if err != nil {
+			t.Errorf("Unexpected parse error for %q: %v", value, err)
+			continue
+		}
+
+		expanded, err := expand(c.Programs[0].Command, nil)
+		if err != nil || expanded != value {
+			t.Errorf("Round trip of %q produced %q (err=%v)", value, expanded, err)
+		}
+	}
+}
+
+func TestRenderKeepsExpressions(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	err := GenerateProgramConfig("test", map[string]string{
+		ProcessName: "%(program_name)s_%(process_num)02d",
+		Command:     "date +%s",
+	}, buffer)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := `[program:test]
+command = date +%%s
+process_name = %(program_name)s_%(process_num)02d
+`
+	if buffer.String() != expected {
+		t.Errorf("Return value does not match expected value:\n%s", buffer.String())
+	}
+}
+
+func TestRenderEnvironment(t *testing.T) {
+	env := map[string]string{
+		"QUOTED": `say "hi" twice`,
+		"LIST":   "a,b c",
+		"EMPTY":  "",
+	}
+
+	p := NewProgramConfig("env", "env")
+	p.Environment = env
+
+	buffer := new(bytes.Buffer)
+	if err := p.Generate(buffer); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !strings.Contains(buffer.String(), `environment = EMPTY="",LIST="a,b c",QUOTED='say "hi" twice'`) {
+		t.Errorf("Unexpected environment rendering:\n%s", buffer.String())
+	}
+
+	c, err := Parse(buffer)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for key, value := range env {
+		if c.Programs[0].Environment[key] != value {
+			t.Errorf("Environment variable %s: expected %q, got %q", key, value, c.Programs[0].Environment[key])
+		}
+	}
+}
+
+func TestRenderRejectsUnrepresentable(t *testing.T) {
+	tests := []map[string]string{
+		{Command: "echo ; comment"},
+		{Command: " padded"},
+		{Command: "a\n\nb"},
+		{Command: "a\n# b"},
+		{Command: ";leading semicolon"},
+		{"Command": "uppercase key"},
+		{"bad key": "x"},
+	}
+
+	for _, options := range tests {
+		if err := GenerateProgramConfig("test", options, new(bytes.Buffer)); err == nil {
+			t.Errorf("Expected error for %q", options)
+		}
+	}
+
+	envTests := []map[string]string{
+		{"A": `both " and '`},
+		{"A": `"quoted"`},
+		{"A": "multi\nline"},
+		{"A B": "x"},
+	}
+
+	for _, env := range envTests {
+		p := NewProgramConfig("env", "env")
+		p.Environment = env
+		if err := p.Generate(new(bytes.Buffer)); err == nil {
+			t.Errorf("Expected error for environment %q", env)
+		}
+	}
+}
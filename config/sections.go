@@ -0,0 +1,127 @@
+package config
+
+// The structures in this file mirror the sections documented at
+// http://supervisord.org/configuration.html. Fields are matched to options
+// through their ini tag; values are stored unexpanded, so %(...)s
+// expressions are kept as written.
+
+type UnixHTTPServer struct {
+	File     string `ini:"file"`
+	Chmod    Octal  `ini:"chmod"`
+	Chown    string `ini:"chown"`
+	Username string `ini:"username"`
+	Password string `ini:"password"`
+}
+
+type InetHTTPServer struct {
+	Port     string `ini:"port"`
+	Username string `ini:"username"`
+	Password string `ini:"password"`
+}
+
+type Supervisord struct {
+	Logfile         string            `ini:"logfile"`
+	LogfileMaxBytes ByteSize          `ini:"logfile_maxbytes"`
+	LogfileBackups  int               `ini:"logfile_backups"`
+	LogLevel        string            `ini:"loglevel"`
+	Pidfile         string            `ini:"pidfile"`
+	UMask           Octal             `ini:"umask"`
+	NoDaemon        bool              `ini:"nodaemon"`
+	Silent          bool              `ini:"silent"`
+	MinFDs          int               `ini:"minfds"`
+	MinProcs        int               `ini:"minprocs"`
+	NoCleanup       bool              `ini:"nocleanup"`
+	ChildLogDir     string            `ini:"childlogdir"`
+	User            string            `ini:"user"`
+	Directory       string            `ini:"directory"`
+	StripAnsi       bool              `ini:"strip_ansi"`
+	Environment     map[string]string `ini:"environment"`
+	Identifier      string            `ini:"identifier"`
+}
+
+type Supervisorctl struct {
+	ServerURL   string `ini:"serverurl"`
+	Username    string `ini:"username"`
+	Password    string `ini:"password"`
+	Prompt      string `ini:"prompt"`
+	HistoryFile string `ini:"history_file"`
+}
+
+// Include lists the file patterns of an [include] section.
+type Include struct {
+	Files []string
+}
+
+type Group struct {
+	Name     string   `ini:"-"`
+	Programs []string `ini:"programs"`
+	Priority int      `ini:"priority"`
+}
+
+type EventListener struct {
+	ProgramConfig
+	BufferSize    int      `ini:"buffer_size"`
+	Events        []string `ini:"events"`
+	ResultHandler string   `ini:"result_handler"`
+}
+
+type FcgiProgram struct {
+	ProgramConfig
+	Socket        string `ini:"socket"`
+	SocketBacklog int    `ini:"socket_backlog"`
+	SocketOwner   string `ini:"socket_owner"`
+	SocketMode    Octal  `ini:"socket_mode"`
+}
+
+// RPCInterface is an [rpcinterface:x] section. Options other than
+// supervisor.rpcinterface_factory are passed to the factory and kept in
+// Options.
+type RPCInterface struct {
+	Name    string            `ini:"-"`
+	Factory string            `ini:"supervisor.rpcinterface_factory"`
+	Options map[string]string `ini:"-"`
+}
+
+// NewSupervisord returns a [supervisord] section with supervisord's defaults.
+func NewSupervisord() *Supervisord {
+	return &Supervisord{
+		Logfile:         "$CWD/supervisord.log",
+		LogfileMaxBytes: 50 * MB,
+		LogfileBackups:  10,
+		LogLevel:        "info",
+		Pidfile:         "$CWD/supervisord.pid",
+		UMask:           022,
+		MinFDs:          1024,
+		MinProcs:        200,
+	}
+}
+
+// NewUnixHTTPServer returns a [unix_http_server] section listening on file.
+func NewUnixHTTPServer(file string) *UnixHTTPServer {
+	return &UnixHTTPServer{File: file, Chmod: 0700}
+}
+
+// DefaultServerURL is the serverurl supervisorctl uses if none is set.
+const DefaultServerURL = "http://localhost:9001"
+
+// NewSupervisorctl returns a [supervisorctl] section connecting to serverURL.
+func NewSupervisorctl(serverURL string) *Supervisorctl {
+	return &Supervisorctl{ServerURL: serverURL}
+}
+
+// NewGroup returns a [group:x] section containing programs.
+func NewGroup(name string, programs ...string) *Group {
+	return &Group{Name: name, Programs: programs, Priority: 999}
+}
+
+// NewEventListener returns an [eventlistener:x] section subscribed to events.
+func NewEventListener(name, command string, events ...string) *EventListener {
+	l := &EventListener{ProgramConfig: *NewProgramConfig(name, command), BufferSize: 10, Events: events}
+	l.Priority = -1
+	return l
+}
+
+// NewFcgiProgram returns an [fcgi-program:x] section bound to socket.
+func NewFcgiProgram(name, command, socket string) *FcgiProgram {
+	return &FcgiProgram{ProgramConfig: *NewProgramConfig(name, command), Socket: socket, SocketMode: 0700}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes as written in options such as
+// stdout_logfile_maxbytes. Values may carry a KB, MB or GB suffix.
+type ByteSize int64
+
+const (
+	KB ByteSize = 1024
+	MB          = 1024 * KB
+	GB          = 1024 * MB
+)
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	multiplier := ByteSize(1)
+	for suffix, m := range map[string]ByteSize{"KB": KB, "MB": MB, "GB": GB} {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix))
+			multiplier = m
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid byte size '%s'", text)
+	}
+
+	*b = ByteSize(n) * multiplier
+	return nil
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	if b < 0 {
+		return nil, fmt.Errorf("invalid byte size %d", int64(b))
+	}
+
+	for _, unit := range []struct {
+		suffix string
+		size   ByteSize
+	}{{"GB", GB}, {"MB", MB}, {"KB", KB}} {
+		if b != 0 && b%unit.size == 0 {
+			return []byte(strconv.FormatInt(int64(b/unit.size), 10) + unit.suffix), nil
+		}
+	}
+	return []byte(strconv.FormatInt(int64(b), 10)), nil
+}
+
+// Octal is an integer written in octal notation, such as umask or chmod.
+type Octal uint32
+
+func (o *Octal) UnmarshalText(text []byte) error {
+	n, err := strconv.ParseUint(strings.TrimSpace(string(text)), 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid octal value '%s'", text)
+	}
+
+	*o = Octal(n)
+	return nil
+}
+
+func (o Octal) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%#o", uint32(o))), nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean '%s'", value)
+}
+
+// parseList splits a comma separated list, dropping empty elements.
+func parseList(value string) (list []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+func isEnvWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c >= 0x80 || strings.IndexByte("_/.+-():", c) >= 0
+}
+
+// tokenizeEnvironment mirrors the (non-POSIX) shlex lexer supervisord uses
+// for environment option values.
+func tokenizeEnvironment(value string) (tokens []string, err error) {
+	for i := 0; i < len(value); {
+		c := value[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(value[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in '%s'", value)
+			}
+			tokens = append(tokens, value[i:i+end+2])
+			i += end + 2
+		case isEnvWordChar(c):
+			start := i
+			for i < len(value) && isEnvWordChar(value[i]) {
+				i++
+			}
+			tokens = append(tokens, value[start:i])
+		default:
+			tokens = append(tokens, value[i:i+1])
+			i++
+		}
+	}
+	return
+}
+
+// parseEnvironment parses a KEY="value",KEY2=value2 list.
+func parseEnvironment(value string) (map[string]string, error) {
+	tokens, err := tokenizeEnvironment(value)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for i := 0; i < len(tokens); i += 4 {
+		if i+3 > len(tokens) || tokens[i+1] != "=" || (i+3 < len(tokens) && tokens[i+3] != ",") {
+			return nil, fmt.Errorf("unexpected end of key/value pairs in '%s'", value)
+		}
+		env[tokens[i]] = strings.Trim(tokens[i+2], `'"`)
+	}
+
+	return env, nil
+}
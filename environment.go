@@ -0,0 +1,132 @@
+package supervisord
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ligustah/xmlrpc"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+var ErrNotSupervised = errors.New("not started by supervisord")
+
+// Environment holds the variables supervisord sets for the programs it
+// starts, see GetEnvironment.
+type Environment struct {
+	// Enabled is set if SUPERVISOR_ENABLED is 1.
+	Enabled bool
+
+	// ProcessName and GroupName are SUPERVISOR_PROCESS_NAME and
+	// SUPERVISOR_GROUP_NAME.
+	ProcessName string
+	GroupName   string
+
+	// ServerURL is SUPERVISOR_SERVER_URL, e.g. http://127.0.0.1:9001 or
+	// unix:///var/run/supervisor.sock.
+	ServerURL string
+
+	// Username and Password are the optional SUPERVISOR_USERNAME and
+	// SUPERVISOR_PASSWORD, used for the server's basic authentication.
+	Username string
+	Password string
+}
+
+// GetEnvironment reads the SUPERVISOR_* variables of the process.
+func GetEnvironment() Environment {
+	return Environment{
+		Enabled:     os.Getenv("SUPERVISOR_ENABLED") == "1",
+		ProcessName: os.Getenv("SUPERVISOR_PROCESS_NAME"),
+		GroupName:   os.Getenv("SUPERVISOR_GROUP_NAME"),
+		ServerURL:   os.Getenv("SUPERVISOR_SERVER_URL"),
+		Username:    os.Getenv("SUPERVISOR_USERNAME"),
+		Password:    os.Getenv("SUPERVISOR_PASSWORD"),
+	}
+}
+
+// Name returns the name supervisord uses for the process, group:name.
+func (e Environment) Name() string {
+	return e.GroupName + ":" + e.ProcessName
+}
+
+// RPCURL returns the XML-RPC endpoint for ServerURL. supervisord passes
+// the address of its HTTP server without the /RPC2 path, which is added;
+// unix:// URLs are returned unchanged.
+func (e Environment) RPCURL() (string, error) {
+	if e.ServerURL == "" {
+		return "", errors.New("SUPERVISOR_SERVER_URL is not set")
+	}
+
+	u, err := url.Parse(e.ServerURL)
+	if err != nil {
+		return "", fmt.Errorf("SUPERVISOR_SERVER_URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return "", fmt.Errorf("SUPERVISOR_SERVER_URL: no socket path in %q", e.ServerURL)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return "", fmt.Errorf("SUPERVISOR_SERVER_URL: no host in %q", e.ServerURL)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/RPC2"
+		}
+	default:
+		return "", fmt.Errorf("SUPERVISOR_SERVER_URL: unsupported scheme in %q", e.ServerURL)
+	}
+	return u.String(), nil
+}
+
+// Connect returns a client for the supervisord that started the process.
+// It fails with ErrNotSupervised if Enabled is not set.
+//
+// Optionally specify a http.Transport to use, will use default
+// http.Transport if nil.
+func (e Environment) Connect(transport *http.Transport) (Supervisor, error) {
+	if !e.Enabled {
+		return nil, ErrNotSupervised
+	}
+
+	rpcURL, err := e.RPCURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if transport == nil {
+		transport = new(http.Transport)
+	}
+	transport.RegisterProtocol("unix", new(supervisorTransport))
+
+	var rt http.RoundTripper = transport
+	if e.Username != "" || e.Password != "" {
+		rt = &basicAuthTransport{e.Username, e.Password, transport}
+	}
+
+	client, err := xmlrpc.NewClient(rpcURL, rt)
+	if err != nil {
+		return nil, err
+	}
+	return &supervisor{client}, nil
+}
+
+// Discover connects to the supervisord that started the process, as
+// described by its environment.
+func Discover() (Supervisor, error) {
+	return GetEnvironment().Connect(nil)
+}
+
+type basicAuthTransport struct {
+	username string
+	password string
+	next     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	//RoundTrippers must not modify the request
+	newReq := req.Clone(req.Context())
+	newReq.SetBasicAuth(t.username, t.password)
+	return t.next.RoundTrip(newReq)
+}
@@ -0,0 +1,90 @@
+package supervisord
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetEnvironment(t *testing.T) {
+	t.Setenv("SUPERVISOR_ENABLED", "1")
+	t.Setenv("SUPERVISOR_PROCESS_NAME", "web_0")
+	t.Setenv("SUPERVISOR_GROUP_NAME", "web")
+	t.Setenv("SUPERVISOR_SERVER_URL", "unix:///var/run/supervisor.sock")
+	t.Setenv("SUPERVISOR_USERNAME", "user")
+	t.Setenv("SUPERVISOR_PASSWORD", "")
+
+	env := GetEnvironment()
+	assert.Equal(t, Environment{
+		Enabled:     true,
+		ProcessName: "web_0",
+		GroupName:   "web",
+		ServerURL:   "unix:///var/run/supervisor.sock",
+		Username:    "user",
+	}, env)
+	assert.Equal(t, "web:web_0", env.Name())
+
+	t.Setenv("SUPERVISOR_ENABLED", "")
+	_, err := Discover()
+	assert.Equal(t, ErrNotSupervised, err)
+}
+
+func TestRPCURL(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		rpcURL    string
+	}{
+		{"http://127.0.0.1:9001", "http://127.0.0.1:9001/RPC2"},
+		{"http://127.0.0.1:9001/", "http://127.0.0.1:9001/RPC2"},
+		{"https://example.com/supervisor/RPC2", "https://example.com/supervisor/RPC2"},
+		{"unix:///var/run/supervisor.sock", "unix:///var/run/supervisor.sock"},
+		{"", ""},
+		{"unix://", ""},
+		{"http:///RPC2", ""},
+		{"ftp://example.com", ""},
+	}
+
+	for _, test := range tests {
+		env := Environment{Enabled: true, ServerURL: test.serverURL}
+		rpcURL, err := env.RPCURL()
+		assert.Equal(t, test.rpcURL, rpcURL, test.serverURL)
+		assert.Equal(t, test.rpcURL == "", err != nil, test.serverURL)
+
+		_, err = env.Connect(nil)
+		assert.Equal(t, test.rpcURL == "", err != nil, test.serverURL)
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "supervisor.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	//larger than any buffer, so the body is still being read from the socket
+	body := strings.Repeat("x", 1<<20)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		w.Header().Set("X-Request", r.URL.Path+" "+user+":"+password)
+		io.WriteString(w, body)
+	}))
+
+	transport := new(http.Transport)
+	transport.RegisterProtocol("unix", new(supervisorTransport))
+	client := &http.Client{Transport: &basicAuthTransport{"user", "secret", transport}}
+
+	resp, err := client.Post("unix://"+sock, "text/xml", strings.NewReader("<methodCall/>"))
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, len(body), len(data))
+		assert.Equal(t, "/RPC2 user:secret", resp.Header.Get("X-Request"))
+	}
+}
@@ -0,0 +1,253 @@
+// Package crashmail implements an event listener sending an email when a
+// process exits unexpectedly, similar to superlance's crashmail.
+//
+// A typical configuration:
+//
+//	[eventlistener:crashmail]
+//	command=crashmail -m ops@example.com
+//	events=PROCESS_STATE_EXITED,PROCESS_STATE_FATAL
+package crashmail
+
+import (
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crash describes a process that exited unexpectedly or could not be
+// started.
+type Crash struct {
+	ProcessName string
+	GroupName   string
+	Pid         int
+
+	// State is the state the process entered, e.g. EXITED or FATAL, and
+	// FromState the one it left.
+	State     string
+	FromState string
+
+	Time time.Time
+
+	// Stderr holds the last lines the process wrote to stderr, if they
+	// could be fetched.
+	Stderr string
+}
+
+// Name returns the name supervisord uses for the process, group:name.
+func (c *Crash) Name() string {
+	return c.GroupName + ":" + c.ProcessName
+}
+
+// Notifier is a listener.Handler mailing crashes. Crashes happening within
+// Window of each other are sent in a single message.
+type Notifier struct {
+	Sender Sender
+	From   string
+	To     []string
+
+	// Subject prefixes the subject of every message, "crashmail" if empty.
+	Subject string
+
+	// Events are the event types reported. Defaults to
+	// PROCESS_STATE_EXITED, for which only unexpected exits are reported.
+	Events []listener.EventType
+
+	// Programs restricts notifications to these process or group names.
+	// All processes are reported if empty.
+	Programs []string
+
+	// TailLines is the number of stderr lines included, 10 if zero. Set it
+	// to a negative value to disable fetching the log. The log is read
+	// through the Supervisor attached to the event.
+	TailLines int
+
+	// TailBytes is the amount of the stderr log fetched, 8KB if zero.
+	TailBytes int64
+
+	// Window is the time crashes are collected before a message is sent.
+	// If zero, every crash is sent immediately. Crashes whose message
+	// could not be sent are kept and sent with the next one.
+	Window time.Duration
+
+	// Logger receives delivery errors of batched messages. If nil, they
+	// are written to stderr.
+	Logger *log.Logger
+
+	mu      sync.Mutex
+	pending []Crash
+	timer   *time.Timer
+}
+
+func (n *Notifier) logf(format string, v ...interface{}) {
+	if n.Logger != nil {
+		n.Logger.Printf(format, v...)
+		return
+	}
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, v...)
+}
+
+func (n *Notifier) reports(e *listener.Event, pse listener.ProcessStateEvent) bool {
+	events := n.Events
+	if len(events) == 0 {
+		events = []listener.EventType{listener.PROCESS_STATE_EXITED}
+	}
+
+	t := e.Header.EventType()
+	matched := false
+	for _, et := range events {
+		if t.Is(et) {
+			matched = true
+			break
+		}
+	}
+	if !matched || (t == listener.PROCESS_STATE_EXITED && pse.Expected) {
+		return false
+	}
+
+	if len(n.Programs) == 0 {
+		return true
+	}
+	for _, name := range n.Programs {
+		if name == pse.ProcessName || name == pse.GroupName || name == pse.GroupName+":"+pse.ProcessName {
+			return true
+		}
+	}
+	return false
+}
+
+// tail fetches the last lines of the process' stderr log.
+func (n *Notifier) tail(e *listener.Event, c *Crash) {
+	if n.TailLines < 0 || e.Supervisor == nil {
+		return
+	}
+
+	length := n.TailBytes
+	if length <= 0 {
+		length = 8192
+	}
+	lines := n.TailLines
+	if lines == 0 {
+		lines = 10
+	}
+
+	output, _, _, err := e.Supervisor.TailProcessStderrLog(c.Name(), 0, length)
+	if err != nil {
+		c.Stderr = fmt.Sprintf("(failed to read stderr log: %v)", err)
+		return
+	}
+
+	split := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(split) > lines {
+		split = split[len(split)-lines:]
+	}
+	c.Stderr = strings.Join(split, "\n")
+}
+
+// HandleEvent reports PROCESS_STATE events according to the Notifier's
+// settings. If a message can't be sent immediately, the event fails so
+// supervisord delivers it again.
+func (n *Notifier) HandleEvent(e *listener.Event) listener.Result {
+	pse, ok := e.Payload.(listener.ProcessStateEvent)
+	if !ok || !n.reports(e, pse) {
+		return listener.RESULT_OK
+	}
+
+	c := Crash{
+		ProcessName: pse.ProcessName,
+		GroupName:   pse.GroupName,
+		Pid:         pse.Pid,
+		State:       strings.TrimPrefix(e.Header.EventName, string(listener.PROCESS_STATE)+"_"),
+		FromState:   pse.FromState,
+		Time:        time.Now(),
+	}
+	n.tail(e, &c)
+
+	if n.Window <= 0 {
+		if err := n.send([]Crash{c}); err != nil {
+			n.logf("Failed to send crash mail for %s: %v", c.Name(), err)
+			return listener.RESULT_FAIL
+		}
+		return listener.RESULT_OK
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.pending = append(n.pending, c)
+	n.schedule()
+	return listener.RESULT_OK
+}
+
+// schedule starts the timer flushing pending crashes if it is not running.
+// n.mu must be held.
+func (n *Notifier) schedule() {
+	if n.timer != nil {
+		return
+	}
+	n.timer = time.AfterFunc(n.Window, func() {
+		if err := n.Flush(); err != nil {
+			n.logf("Failed to send crash mail: %v", err)
+		}
+	})
+}
+
+// Flush sends the crashes collected so far. If that fails, they are kept
+// and sent again after Window, together with newer ones.
+func (n *Notifier) Flush() error {
+	n.mu.Lock()
+	crashes := n.pending
+	n.pending = nil
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.mu.Unlock()
+
+	if len(crashes) == 0 {
+		return nil
+	}
+
+	err := n.send(crashes)
+	if err != nil {
+		n.mu.Lock()
+		n.pending = append(crashes, n.pending...)
+		if n.Window > 0 {
+			n.schedule()
+		}
+		n.mu.Unlock()
+	}
+	return err
+}
+
+func (n *Notifier) send(crashes []Crash) error {
+	prefix := n.Subject
+	if prefix == "" {
+		prefix = "crashmail"
+	}
+
+	m := &Message{From: n.From, To: n.To}
+	if len(crashes) == 1 {
+		m.Subject = fmt.Sprintf("%s: %s %s", prefix, crashes[0].Name(), strings.ToLower(crashes[0].State))
+	} else {
+		m.Subject = fmt.Sprintf("%s: %d processes crashed", prefix, len(crashes))
+	}
+
+	var body strings.Builder
+	for i, c := range crashes {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "Process %s (pid %d) entered state %s from %s at %s.\n",
+			c.Name(), c.Pid, c.State, c.FromState, c.Time.Format(time.RFC1123Z))
+		if c.Stderr != "" {
+			fmt.Fprintf(&body, "\nLast stderr output:\n\n%s\n", c.Stderr)
+		}
+	}
+	m.Body = body.String()
+
+	return n.Sender.Send(m)
+}
@@ -0,0 +1,219 @@
+package crashmail
+
+import (
+	"bufio"
+	"errors"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a minimal SMTP server accepting every message.
+type smtpServer struct {
+	ln       net.Listener
+	messages chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpServer{ln: ln, messages: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+		case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.messages <- data.String()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+type fakeSupervisor struct {
+	supervisor.Supervisor
+	stderr string
+}
+
+func (f *fakeSupervisor) TailProcessStderrLog(name string, offset, length int64) (string, int64, bool, error) {
+	if name != "web:web_0" {
+		return "", 0, false, errors.New("BAD_NAME")
+	}
+	if int64(len(f.stderr)) > length {
+		return f.stderr[int64(len(f.stderr))-length:], int64(len(f.stderr)), true, nil
+	}
+	return f.stderr, int64(len(f.stderr)), false, nil
+}
+
+func stateEvent(name string, expected bool) *listener.Event {
+	return &listener.Event{
+		Header: listener.Header{EventName: name},
+		Payload: listener.ProcessStateEvent{ProcessState: listener.ProcessState{
+			ProcessName: "web_0",
+			GroupName:   "web",
+			FromState:   "RUNNING",
+			Pid:         4242,
+			Expected:    expected,
+		}},
+		Supervisor: &fakeSupervisor{stderr: "line 1\nline 2\nline 3\npanic: oops\n"},
+	}
+}
+
+func TestNotifierSMTP(t *testing.T) {
+	server := newSMTPServer(t)
+	n := &Notifier{
+		Sender:    &SMTPSender{Addr: server.ln.Addr().String()},
+		From:      "supervisor@example.com",
+		To:        []string{"ops@example.com"},
+		TailLines: 2,
+	}
+
+	assert.Equal(t, listener.RESULT_OK, n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", true)))
+	assert.Equal(t, listener.RESULT_OK, n.HandleEvent(stateEvent("PROCESS_STATE_FATAL", false)))
+	assert.Equal(t, listener.RESULT_OK, n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false)))
+
+	select {
+	case msg := <-server.messages:
+		assert.Contains(t, msg, "Subject: crashmail: web:web_0 exited\r\n")
+		assert.Contains(t, msg, "To: ops@example.com\r\n")
+		assert.Contains(t, msg, "Process web:web_0 (pid 4242) entered state EXITED from RUNNING")
+		assert.Contains(t, msg, "line 3\r\npanic: oops\r\n")
+		assert.NotContains(t, msg, "line 2")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	assert.Empty(t, server.messages)
+}
+
+type recorder struct {
+	messages []*Message
+	err      error
+}
+
+func (r *recorder) Send(m *Message) error {
+	r.messages = append(r.messages, m)
+	return r.err
+}
+
+func TestNotifierFilter(t *testing.T) {
+	r := &recorder{}
+	n := &Notifier{
+		Sender:   r,
+		To:       []string{"ops@example.com"},
+		Events:   []listener.EventType{listener.PROCESS_STATE_EXITED, listener.PROCESS_STATE_FATAL},
+		Programs: []string{"web"},
+	}
+
+	n.HandleEvent(stateEvent("PROCESS_STATE_FATAL", false))
+	n.HandleEvent(stateEvent("PROCESS_STATE_BACKOFF", false))
+	n.Programs = []string{"db"}
+	n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false))
+
+	if assert.Len(t, r.messages, 1) {
+		assert.Equal(t, "crashmail: web:web_0 fatal", r.messages[0].Subject)
+	}
+
+	//delivery errors fail the event so it is retried
+	n.Programs = nil
+	n.Logger = log.New(io.Discard, "", 0)
+	r.err = errors.New("connection refused")
+	assert.Equal(t, listener.RESULT_FAIL, n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false)))
+}
+
+func TestNotifierWindow(t *testing.T) {
+	r := &recorder{}
+	n := &Notifier{Sender: r, To: []string{"ops@example.com"}, Window: time.Hour, Subject: "[prod]"}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, listener.RESULT_OK, n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false)))
+	}
+	assert.Empty(t, r.messages)
+
+	assert.NoError(t, n.Flush())
+	if assert.Len(t, r.messages, 1) {
+		assert.Equal(t, "[prod]: 3 processes crashed", r.messages[0].Subject)
+		assert.Equal(t, 3, strings.Count(r.messages[0].Body, "Process web:web_0"))
+	}
+
+	assert.NoError(t, n.Flush())
+	assert.Len(t, r.messages, 1)
+
+	//crashes of a failed message are sent with the next one
+	n.Logger = log.New(io.Discard, "", 0)
+	r.err = errors.New("connection refused")
+	n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false))
+	assert.Error(t, n.Flush())
+
+	r.err = nil
+	n.HandleEvent(stateEvent("PROCESS_STATE_EXITED", false))
+	assert.NoError(t, n.Flush())
+	if assert.Len(t, r.messages, 3) {
+		assert.Equal(t, "[prod]: 2 processes crashed", r.messages[2].Subject)
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	m := &Message{
+		From:    "supervisor@example.com",
+		To:      []string{"ops@example.com\r\nBcc: evil@example.com"},
+		Subject: "crashmail: web\nX-Injected: 1 exited",
+		Body:    "body\n",
+	}
+
+	data := string(m.Bytes())
+	assert.Contains(t, data, "To: ops@example.com Bcc: evil@example.com\r\n")
+	assert.Contains(t, data, "Subject: crashmail: web X-Injected: 1 exited\r\n")
+	assert.NotContains(t, data, "\nBcc:")
+	assert.NotContains(t, data, "\nX-Injected:")
+}
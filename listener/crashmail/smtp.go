@@ -0,0 +1,57 @@
+package crashmail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is an email to be delivered by a Sender.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// headerValue replaces line breaks, which would end the header and could
+// add others, e.g. from a process name.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+}
+
+// Bytes returns the message in RFC 5322 format.
+func (m *Message) Bytes() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(m.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(strings.Join(m.To, ", ")))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(m.Body, "\n", "\r\n", -1))
+	return []byte(b.String())
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(*Message) error
+}
+
+// SMTPSender delivers messages to an SMTP server.
+type SMTPSender struct {
+	// Addr is the host:port of the server.
+	Addr string
+
+	// Auth is used if the server supports authentication; may be nil.
+	Auth smtp.Auth
+}
+
+func (s *SMTPSender) Send(m *Message) error {
+	if len(m.To) == 0 {
+		return fmt.Errorf("crashmail: no recipients")
+	}
+	return smtp.SendMail(s.Addr, s.Auth, m.From, m.To, m.Bytes())
+}
@@ -0,0 +1,159 @@
+package listener
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when a job runs next.
+type Schedule interface {
+	// Next returns the first run time after t.
+	Next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Every returns a Schedule running a job every d, starting d after the
+// first tick the Scheduler receives.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+// cronSchedule holds the allowed values of each field as bit sets.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar are set if the field started with *, e.g. */2,
+	// as in cron; see matchDay.
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Cron parses a schedule in the five field crontab format: minute, hour,
+// day of month, month and day of week. Fields may be *, numbers, ranges
+// (1-5), steps (*/15, 0-30/10) and comma separated lists of those. Sunday
+// is 0 or 7. As in cron, a day matches if either the day of month or the
+// day of week matches, unless one of them is *.
+func Cron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+
+	//7 is an alias for sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cronSchedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, f cronField) (set uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if idx := strings.IndexByte(part, '/'); idx >= 0 {
+			rng = part[:idx]
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, part)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.IndexByte(rng, '-') >= 0:
+			bounds := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(bounds[0])
+			if err == nil {
+				hi, err = strconv.Atoi(bounds[1])
+			}
+		default:
+			lo, err = strconv.Atoi(rng)
+			hi = lo
+			if strings.IndexByte(part, '/') >= 0 {
+				hi = f.max
+			}
+		}
+
+		if err != nil || lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("invalid %s field %q", f.name, part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+	return dom || dow
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	//give up on expressions that never match, such as the 31st of february
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
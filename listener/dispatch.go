@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// call passes e to handler, turning a panic into RESULT_FAIL.
+func (l *Listener) call(handler Handler, e *Event) (result Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.logf("Handler for %s event %d panicked: %v\n%s", e.Header.EventName, e.Header.Serial, r, debug.Stack())
+			result = RESULT_FAIL
+		}
+	}()
+
+	return handler.HandleEvent(e)
+}
+
+// DefaultMaxAbandoned is the number of timed out handlers that may still
+// be running if Listener.MaxAbandoned is not set.
+const DefaultMaxAbandoned = 16
+
+// invoke passes e to handler, enforcing l.Timeout.
+func (l *Listener) invoke(handler Handler, e *Event) Result {
+	if l.Timeout <= 0 {
+		return l.call(handler, e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+	e.ctx = ctx
+
+	//0 while running, 1 once finished in time, 2 if abandoned
+	var state int32
+	done := make(chan Result, 1)
+	go func() {
+		result := l.call(handler, e)
+		if !atomic.CompareAndSwapInt32(&state, 0, 1) {
+			atomic.AddInt32(&l.abandoned, -1)
+		}
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+	}
+
+	maxAbandoned := l.MaxAbandoned
+	if maxAbandoned == 0 {
+		maxAbandoned = DefaultMaxAbandoned
+	}
+	if n := atomic.AddInt32(&l.abandoned, 1); n > int32(maxAbandoned) {
+		atomic.AddInt32(&l.abandoned, -1)
+		l.logf("Handler for %s event %d timed out after %v, waiting for it since %d handlers are still running", e.Header.EventName, e.Header.Serial, l.Timeout, n-1)
+		return <-done
+	}
+	if !atomic.CompareAndSwapInt32(&state, 0, 2) {
+		//finished in the meantime, too late all the same
+		atomic.AddInt32(&l.abandoned, -1)
+	}
+
+	result := l.TimeoutResult
+	if result == "" {
+		result = RESULT_FAIL
+	}
+	l.logf("Handler for %s event %d timed out after %v, returning %s", e.Header.EventName, e.Header.Serial, l.Timeout, string(result))
+	return result
+}
+
+// startWorkers starts the goroutines handling queued events. They exit
+// once the returned channel is closed and drained; wait blocks until then.
+func (l *Listener) startWorkers() (queue chan *Event, wait func()) {
+	queue = make(chan *Event, l.QueueSize)
+	handler := l.handler()
+
+	workers := l.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for e := range queue {
+				if result := l.invoke(handler, e); result != RESULT_OK {
+					l.logf("Handler for %s event %d returned %s after it was acknowledged", e.Header.EventName, e.Header.Serial, string(result))
+				}
+			}
+		}()
+	}
+
+	return queue, wg.Wait
+}
+
+// enqueue parses an event and queues it for the workers.
+func (l *Listener) enqueue(queue chan *Event, h Header, payload []byte) Result {
+	if r, ok := l.handler().(*Router); ok && r.Handler(h.EventType()) == nil {
+		return RESULT_OK
+	}
+
+	e, err := l.event(h, payload)
+	if err != nil {
+		l.logf("Failed to parse %s event %d: %v", h.EventName, h.Serial, err)
+		return RESULT_FAIL
+	}
+
+	select {
+	case queue <- e:
+		return RESULT_OK
+	default:
+		l.logf("Queue full, rejecting %s event %d", h.EventName, h.Serial)
+		return RESULT_FAIL
+	}
+}
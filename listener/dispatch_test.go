@@ -0,0 +1,123 @@
+package listener
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListenerPanic(t *testing.T) {
+	l := NewListener(nil, nil, HandlerFunc(func(e *Event) Result {
+		panic("boom")
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+}
+
+func TestListenerTimeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	l := NewListener(nil, nil, HandlerFunc(func(e *Event) Result {
+		<-e.Context().Done()
+		close(cancelled)
+		return RESULT_FAIL
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+	l.Timeout = 10 * time.Millisecond
+	l.TimeoutResult = RESULT_OK
+
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+	<-cancelled
+
+	l.TimeoutResult = ""
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+}
+
+func TestListenerMaxAbandoned(t *testing.T) {
+	release := make(chan struct{})
+	l := NewListener(nil, nil, HandlerFunc(func(e *Event) Result {
+		<-release
+		return RESULT_OK
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+	l.Timeout = 10 * time.Millisecond
+	l.MaxAbandoned = 1
+
+	//the first handler is abandoned, the second one waited for
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	start := time.Now()
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	//the abandoned handler has returned as well
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&l.abandoned) == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+}
+
+func TestListenerQueue(t *testing.T) {
+	inReader, in := io.Pipe()
+	outReader, out := io.Pipe()
+	output := bufio.NewReader(outReader)
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	var handled []int
+	l := NewListener(inReader, out, HandlerFunc(func(e *Event) Result {
+		started <- struct{}{}
+		<-release
+		handled = append(handled, e.Header.Serial)
+		return RESULT_OK
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+	l.QueueSize = 1
+
+	done := make(chan error)
+	go func() {
+		done <- l.Run()
+		out.Close()
+	}()
+
+	expect := func(s string) {
+		buf := make([]byte, len(s))
+		_, err := io.ReadFull(output, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, s, string(buf))
+	}
+	send := func(serial int) {
+		fmt.Fprintf(in, "ver:3.0 server:supervisor serial:%d pool:listener poolserial:%d eventname:TICK_5 len:6\nwhen:5", serial, serial)
+	}
+
+	expect("READY\n")
+	send(1)
+	expect("RESULT 2\nOKREADY\n")
+
+	//the worker is busy with the first event, the second one fills the queue
+	<-started
+	send(2)
+	expect("RESULT 2\nOKREADY\n")
+	send(3)
+	expect("RESULT 4\nFAILREADY\n")
+
+	close(release)
+	in.Close()
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int{1, 2}, handled)
+}
+
+func TestListenerQueueUnrouted(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc(TICK_5, func(e *Event) Result { return RESULT_OK })
+	l := NewListener(nil, nil, r)
+	l.Logger = log.New(io.Discard, "", 0)
+
+	queue := make(chan *Event, 1)
+	assert.Equal(t, RESULT_OK, l.enqueue(queue, Header{EventName: "PROCESS_STATE_RUNNING"}, []byte("garbage")))
+	assert.Empty(t, queue)
+	assert.Equal(t, RESULT_FAIL, l.enqueue(queue, Header{EventName: "TICK_5"}, []byte("garbage")))
+}
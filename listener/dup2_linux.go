@@ -0,0 +1,8 @@
+package listener
+
+import "syscall"
+
+// dup2 makes newfd a copy of oldfd. Some architectures lack dup2 itself.
+func dup2(oldfd, newfd int) error {
+	return syscall.Dup3(oldfd, newfd, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 )
 
+// Deprecated: use supervisor.GetEnvironment.
 var (
 	SupervisorProcessName = os.Getenv("SUPERVISOR_PROCESS_NAME")
 	SupervisorGroupName   = os.Getenv("SUPERVISOR_GROUP_NAME")
@@ -12,9 +13,14 @@ var (
 	SupervisorEnabled     = os.Getenv("SUPERVISOR_ENABLED")
 )
 
+// GetSupervisor connects to the supervisord that started the process and
+// panics if that fails.
+//
+// Deprecated: use supervisor.Discover, which returns an error instead.
 func GetSupervisor() supervisor.Supervisor {
-	if SupervisorEnabled != "1" {
-		panic("Must be started by supervisor")
+	s, err := supervisor.Discover()
+	if err != nil {
+		panic(err)
 	}
-	return supervisor.New(SupervisorURL, nil)
+	return s
 }
@@ -0,0 +1,142 @@
+package listener
+
+import (
+	"strings"
+)
+
+// EventType is the name of a supervisor event type. Like the event classes
+// in supervisor, types form a hierarchy rooted at EVENT; a handler for a
+// type receives the events of all its descendants.
+type EventType string
+
+const (
+	EVENT EventType = "EVENT"
+
+	PROCESS_STATE          EventType = "PROCESS_STATE"
+	PROCESS_STATE_STOPPED  EventType = "PROCESS_STATE_STOPPED"
+	PROCESS_STATE_STARTING EventType = "PROCESS_STATE_STARTING"
+	PROCESS_STATE_RUNNING  EventType = "PROCESS_STATE_RUNNING"
+	PROCESS_STATE_BACKOFF  EventType = "PROCESS_STATE_BACKOFF"
+	PROCESS_STATE_STOPPING EventType = "PROCESS_STATE_STOPPING"
+	PROCESS_STATE_EXITED   EventType = "PROCESS_STATE_EXITED"
+	PROCESS_STATE_FATAL    EventType = "PROCESS_STATE_FATAL"
+	PROCESS_STATE_UNKNOWN  EventType = "PROCESS_STATE_UNKNOWN"
+
+	REMOTE_COMMUNICATION EventType = "REMOTE_COMMUNICATION"
+
+	PROCESS_LOG        EventType = "PROCESS_LOG"
+	PROCESS_LOG_STDOUT EventType = "PROCESS_LOG_STDOUT"
+	PROCESS_LOG_STDERR EventType = "PROCESS_LOG_STDERR"
+
+	PROCESS_COMMUNICATION        EventType = "PROCESS_COMMUNICATION"
+	PROCESS_COMMUNICATION_STDOUT EventType = "PROCESS_COMMUNICATION_STDOUT"
+	PROCESS_COMMUNICATION_STDERR EventType = "PROCESS_COMMUNICATION_STDERR"
+
+	SUPERVISOR_STATE_CHANGE          EventType = "SUPERVISOR_STATE_CHANGE"
+	SUPERVISOR_STATE_CHANGE_RUNNING  EventType = "SUPERVISOR_STATE_CHANGE_RUNNING"
+	SUPERVISOR_STATE_CHANGE_STOPPING EventType = "SUPERVISOR_STATE_CHANGE_STOPPING"
+
+	TICK      EventType = "TICK"
+	TICK_5    EventType = "TICK_5"
+	TICK_60   EventType = "TICK_60"
+	TICK_3600 EventType = "TICK_3600"
+
+	PROCESS_GROUP         EventType = "PROCESS_GROUP"
+	PROCESS_GROUP_ADDED   EventType = "PROCESS_GROUP_ADDED"
+	PROCESS_GROUP_REMOVED EventType = "PROCESS_GROUP_REMOVED"
+
+	EVENT_BUFFER_OVERFLOW EventType = "EVENT_BUFFER_OVERFLOW"
+)
+
+var eventParents = map[EventType]EventType{
+	PROCESS_STATE:          EVENT,
+	PROCESS_STATE_STOPPED:  PROCESS_STATE,
+	PROCESS_STATE_STARTING: PROCESS_STATE,
+	PROCESS_STATE_RUNNING:  PROCESS_STATE,
+	PROCESS_STATE_BACKOFF:  PROCESS_STATE,
+	PROCESS_STATE_STOPPING: PROCESS_STATE,
+	PROCESS_STATE_EXITED:   PROCESS_STATE,
+	PROCESS_STATE_FATAL:    PROCESS_STATE,
+	PROCESS_STATE_UNKNOWN:  PROCESS_STATE,
+
+	REMOTE_COMMUNICATION: EVENT,
+
+	PROCESS_LOG:        EVENT,
+	PROCESS_LOG_STDOUT: PROCESS_LOG,
+	PROCESS_LOG_STDERR: PROCESS_LOG,
+
+	PROCESS_COMMUNICATION:        EVENT,
+	PROCESS_COMMUNICATION_STDOUT: PROCESS_COMMUNICATION,
+	PROCESS_COMMUNICATION_STDERR: PROCESS_COMMUNICATION,
+
+	SUPERVISOR_STATE_CHANGE:          EVENT,
+	SUPERVISOR_STATE_CHANGE_RUNNING:  SUPERVISOR_STATE_CHANGE,
+	SUPERVISOR_STATE_CHANGE_STOPPING: SUPERVISOR_STATE_CHANGE,
+
+	TICK:      EVENT,
+	TICK_5:    TICK,
+	TICK_60:   TICK,
+	TICK_3600: TICK,
+
+	PROCESS_GROUP:         EVENT,
+	PROCESS_GROUP_ADDED:   PROCESS_GROUP,
+	PROCESS_GROUP_REMOVED: PROCESS_GROUP,
+
+	EVENT_BUFFER_OVERFLOW: EVENT,
+}
+
+// Parent returns the type t derives from. Types unknown to this package
+// derive from the type named by their name up to the last underscore, so
+// a future TICK_10 is a TICK. The parent of EVENT is EVENT.
+func (t EventType) Parent() EventType {
+	if parent, ok := eventParents[t]; ok {
+		return parent
+	}
+	if t == EVENT {
+		return EVENT
+	}
+
+	name := string(t)
+	for {
+		idx := strings.LastIndexByte(name, '_')
+		if idx < 0 {
+			return EVENT
+		}
+		name = name[:idx]
+		if _, ok := eventParents[EventType(name)]; ok {
+			return EventType(name)
+		}
+	}
+}
+
+// Is reports whether t is ancestor or one of its descendants.
+func (t EventType) Is(ancestor EventType) bool {
+	for {
+		if t == ancestor {
+			return true
+		}
+		if t == EVENT {
+			return false
+		}
+		t = t.Parent()
+	}
+}
+
+// depth returns the number of ancestors of t.
+func (t EventType) depth() (n int) {
+	for ; t != EVENT; t = t.Parent() {
+		n++
+	}
+	return
+}
+
+// suffix returns the part of the name of t following the name of its
+// parent, e.g. STDOUT for PROCESS_LOG_STDOUT.
+func (t EventType) suffix() string {
+	return eventSuffix(string(t), string(t.Parent()))
+}
+
+// EventType returns the type of the event.
+func (h Header) EventType() EventType {
+	return EventType(h.EventName)
+}
@@ -0,0 +1,24 @@
+package listener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventTypeHierarchy(t *testing.T) {
+	assert.Equal(t, PROCESS_STATE, PROCESS_STATE_EXITED.Parent())
+	assert.Equal(t, EVENT, PROCESS_STATE.Parent())
+	assert.Equal(t, EVENT, EVENT.Parent())
+	assert.Equal(t, TICK, EventType("TICK_10").Parent())
+	assert.Equal(t, EVENT, EventType("CUSTOM_EVENT").Parent())
+
+	assert.True(t, PROCESS_STATE_EXITED.Is(PROCESS_STATE))
+	assert.True(t, PROCESS_STATE_EXITED.Is(EVENT))
+	assert.True(t, TICK_60.Is(TICK_60))
+	assert.False(t, TICK_60.Is(TICK_5))
+	assert.False(t, PROCESS_STATE.Is(PROCESS_STATE_EXITED))
+	assert.False(t, EVENT_BUFFER_OVERFLOW.Is(EventType("EVENT_BUFFER")))
+
+	assert.Equal(t, 0, EVENT.depth())
+	assert.Equal(t, 2, PROCESS_COMMUNICATION_STDERR.depth())
+}
@@ -0,0 +1,265 @@
+// Package httpok implements an event listener restarting programs that
+// stop responding to health checks, similar to superlance's httpok.
+//
+// The Checker probes on every TICK event it receives and needs a
+// Supervisor attached to the listener:
+//
+//	[eventlistener:httpok]
+//	command=httpok -p web -u http://localhost:8080/health
+//	events=TICK_60
+//
+// A restart waits for the program to stop and start again, which can take
+// stopwaitsecs plus startsecs. Run the Listener with QueueSize set, so
+// events are acknowledged while a restart is in progress instead of piling
+// up in supervisord's buffer for the pool.
+package httpok
+
+import (
+	"context"
+	"fmt"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/state"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check describes how a program is probed.
+type Check struct {
+	// Program is the name passed to StopProcess and StartProcess, e.g.
+	// web:web_0 or web:*.
+	Program string
+
+	// URL is probed with a GET request. A tcp://host:port URL only checks
+	// that a connection can be established.
+	URL string
+
+	// Timeout limits a probe, 10 seconds if zero.
+	Timeout time.Duration
+
+	// Status is the expected HTTP status code, 200 if zero. Body, if set,
+	// must be contained in the response body.
+	Status int
+	Body   string
+
+	// Failures is the number of consecutive failed probes after which the
+	// program is restarted, 1 if zero.
+	Failures int
+
+	// Signal is sent to the program before restarting it, e.g. QUIT to
+	// make a JVM write a thread dump. SignalDelay is the time waited after
+	// sending it.
+	Signal      string
+	SignalDelay time.Duration
+}
+
+// Failure describes a failed probe.
+type Failure struct {
+	Program string
+	URL     string
+	Err     error
+
+	// Consecutive is the number of failed probes in a row.
+	Consecutive int
+
+	// Restarted is set if the program was restarted; RestartErr holds the
+	// error if that failed.
+	Restarted  bool
+	RestartErr error
+}
+
+// Checker is a listener.Handler probing programs and restarting those
+// failing their checks.
+type Checker struct {
+	Checks []Check
+
+	// Client is used for HTTP probes, http.DefaultClient if nil.
+	Client *http.Client
+
+	// Notify is called for every failed probe.
+	Notify func(Failure)
+
+	// Logger receives diagnostics. If nil, they are written to stderr.
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (c *Checker) logf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+		return
+	}
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, v...)
+}
+
+// HandleEvent probes all programs on TICK events. The event is always
+// acknowledged.
+func (c *Checker) HandleEvent(e *listener.Event) listener.Result {
+	if _, ok := e.Payload.(listener.Tick); !ok {
+		return listener.RESULT_OK
+	}
+	if e.Supervisor == nil {
+		c.logf("httpok: no supervisor attached to the listener")
+		return listener.RESULT_OK
+	}
+
+	c.Run(e.Supervisor)
+	return listener.RESULT_OK
+}
+
+// Run probes all programs concurrently and restarts those that failed too
+// often. It returns the failed probes in the order of Checks.
+func (c *Checker) Run(s supervisor.Supervisor) []Failure {
+	results := make([]*Failure, len(c.Checks))
+
+	var wg sync.WaitGroup
+	for i := range c.Checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.check(s, c.Checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failures []Failure
+	for _, f := range results {
+		if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+	return failures
+}
+
+// count updates the consecutive failures of a check and returns them.
+func (c *Checker) count(check Check, failed bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures == nil {
+		c.failures = make(map[string]int)
+	}
+
+	key := check.Program + " " + check.URL
+	if !failed {
+		delete(c.failures, key)
+		return 0
+	}
+	c.failures[key]++
+	return c.failures[key]
+}
+
+func (c *Checker) check(s supervisor.Supervisor, check Check) *Failure {
+	//stopped programs are not expected to respond; names like group:* have no info
+	if info, err := s.GetProcessInfo(check.Program); err == nil && info.State != state.RUNNING {
+		c.count(check, false)
+		return nil
+	}
+
+	err := c.probe(check)
+	consecutive := c.count(check, err != nil)
+	if err == nil {
+		return nil
+	}
+
+	f := &Failure{Program: check.Program, URL: check.URL, Err: err, Consecutive: consecutive}
+	threshold := check.Failures
+	if threshold < 1 {
+		threshold = 1
+	}
+	if consecutive >= threshold {
+		f.Restarted = true
+		f.RestartErr = c.restart(s, check)
+		c.count(check, false)
+	}
+
+	c.logf("httpok: %s: %v (%d in a row, restarted: %v, error: %v)", check.Program, err, consecutive, f.Restarted, f.RestartErr)
+	if c.Notify != nil {
+		c.Notify(*f)
+	}
+	return f
+}
+
+func (c *Checker) probe(check Check) error {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	u, err := url.Parse(check.URL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme == "tcp" {
+		conn, err := net.DialTimeout("tcp", u.Host, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	status := check.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.StatusCode != status {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, status)
+	}
+
+	if check.Body != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), check.Body) {
+			return fmt.Errorf("body does not contain %q", check.Body)
+		}
+	}
+	return nil
+}
+
+// restart sends the signal of the check, if any, and restarts the program.
+// The program is restarted even if it could not be signalled.
+func (c *Checker) restart(s supervisor.Supervisor, check Check) error {
+	if check.Signal != "" {
+		if _, err := s.SignalProcess(check.Program, check.Signal); err != nil {
+			c.logf("httpok: failed to send %s to %s: %v", check.Signal, check.Program, err)
+		} else {
+			time.Sleep(check.SignalDelay)
+		}
+	}
+
+	if _, err := s.StopProcess(check.Program, true); err != nil {
+		return err
+	}
+	_, err := s.StartProcess(check.Program, true)
+	return err
+}
@@ -0,0 +1,147 @@
+package httpok
+
+import (
+	"errors"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/state"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSupervisor struct {
+	supervisor.Supervisor
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeSupervisor) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeSupervisor) GetProcessInfo(name string) (supervisor.ProcessInfo, error) {
+	switch name {
+	case "stopped":
+		return supervisor.ProcessInfo{Name: name, State: state.STOPPED}, nil
+	case "web:*":
+		return supervisor.ProcessInfo{}, errors.New("BAD_NAME")
+	}
+	return supervisor.ProcessInfo{Name: name, State: state.RUNNING}, nil
+}
+
+func (f *fakeSupervisor) SignalProcess(name, signal string) (bool, error) {
+	f.record("signal " + name + " " + signal)
+	return true, nil
+}
+
+func (f *fakeSupervisor) StopProcess(name string, wait bool) (bool, error) {
+	f.record("stop " + name)
+	return true, nil
+}
+
+func (f *fakeSupervisor) StartProcess(name string, wait bool) (bool, error) {
+	f.record("start " + name)
+	return true, nil
+}
+
+func TestChecker(t *testing.T) {
+	var mu sync.Mutex
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case !healthy:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/health":
+			io.WriteString(w, "status: ok")
+		default:
+			io.WriteString(w, "status: degraded")
+		}
+	}))
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tcpAddr := ln.Addr().String()
+	ln.Close()
+
+	s := &fakeSupervisor{}
+	c := &Checker{
+		Checks: []Check{
+			{Program: "web:*", URL: server.URL + "/health", Body: "ok", Failures: 2, Signal: "QUIT"},
+			{Program: "api", URL: server.URL + "/api", Body: "ok"},
+			{Program: "slow", URL: server.URL + "/slow", Timeout: 50 * time.Millisecond, Failures: 3},
+			{Program: "stopped", URL: server.URL + "/health", Status: 500},
+			{Program: "db", URL: "tcp://" + tcpAddr},
+		},
+		Logger: log.New(io.Discard, "", 0),
+	}
+
+	tick := func() {
+		result := c.HandleEvent(&listener.Event{
+			Header:     listener.Header{EventName: "TICK_60"},
+			Payload:    listener.Tick{When: 60},
+			Supervisor: s,
+		})
+		assert.Equal(t, listener.RESULT_OK, result)
+	}
+
+	failures := c.Run(s)
+	if assert.Len(t, failures, 3) {
+		assert.Equal(t, "api", failures[0].Program)
+		assert.EqualError(t, failures[0].Err, `body does not contain "ok"`)
+		assert.True(t, failures[0].Restarted)
+
+		assert.Equal(t, "slow", failures[1].Program)
+		assert.Equal(t, 1, failures[1].Consecutive)
+		assert.False(t, failures[1].Restarted)
+
+		assert.Equal(t, "db", failures[2].Program)
+		assert.True(t, failures[2].Restarted)
+	}
+
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+
+	s.calls = nil
+	tick()
+	assert.NotContains(t, strings.Join(s.calls, ","), "web:*")
+
+	s.calls = nil
+	tick()
+	assert.Contains(t, s.calls, "signal web:* QUIT")
+	assert.Contains(t, s.calls, "stop web:*")
+	assert.Contains(t, s.calls, "start web:*")
+	assert.Contains(t, s.calls, "stop slow")
+
+	//a successful probe resets the counter
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	tick()
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+
+	s.calls = nil
+	tick()
+	assert.NotContains(t, strings.Join(s.calls, ","), "web:*")
+}
@@ -0,0 +1,149 @@
+package listenertest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Step is an event of a conformance suite.
+type Step struct {
+	Event   listener.EventType `json:"event"`
+	Payload string             `json:"payload"`
+
+	// Expect is the result the listener should return, any if empty.
+	Expect listener.Result `json:"expect,omitempty"`
+}
+
+// Report is the outcome of RunSuite.
+type Report struct {
+	// Deliveries are all events sent, including redeliveries.
+	Deliveries []Delivery
+
+	// Unexpected describes the steps whose result differed from Expect and
+	// the steps not delivered because an earlier event kept failing.
+	Unexpected []string
+
+	// Err is the protocol violation or I/O error that stopped the suite.
+	Err error
+}
+
+// OK reports whether the suite ran without problems.
+func (r *Report) OK() bool {
+	return r.Err == nil && len(r.Unexpected) == 0
+}
+
+// DefaultSuite returns an event of every type supervisord sends, with
+// realistic payloads.
+func DefaultSuite() []Step {
+	web := listener.ProcessState{ProcessName: "web_0", GroupName: "web", Pid: 4242}
+	state := func(t listener.EventType, from string, tries int, expected bool) Step {
+		ps := web
+		ps.FromState, ps.Tries, ps.Expected = from, tries, expected
+		return Step{Event: t, Payload: ProcessStatePayload(t, ps)}
+	}
+
+	return []Step{
+		{Event: listener.SUPERVISOR_STATE_CHANGE_RUNNING},
+		state(listener.PROCESS_STATE_STARTING, "STOPPED", 0, false),
+		state(listener.PROCESS_STATE_RUNNING, "STARTING", 0, false),
+		{Event: listener.PROCESS_LOG_STDOUT, Payload: ProcessLogPayload(listener.ProcessLog{ProcessName: "web_0", GroupName: "web", Pid: 4242, Data: "listening on :8080\n"})},
+		{Event: listener.PROCESS_LOG_STDERR, Payload: ProcessLogPayload(listener.ProcessLog{ProcessName: "web_0", GroupName: "web", Pid: 4242, Data: "warning: low memory\n"})},
+		{Event: listener.PROCESS_COMMUNICATION_STDOUT, Payload: ProcessCommunicationPayload(listener.ProcessCommunication{ProcessName: "web_0", GroupName: "web", Pid: 4242, Data: "<data>\n"})},
+		{Event: listener.REMOTE_COMMUNICATION, Payload: RemoteCommunicationPayload(listener.RemoteCommunication{Type: "deploy", Data: "version 2"})},
+		{Event: listener.TICK_5, Payload: TickPayload(1700000005)},
+		{Event: listener.TICK_60, Payload: TickPayload(1700000040)},
+		{Event: listener.TICK_3600, Payload: TickPayload(1700002800)},
+		state(listener.PROCESS_STATE_EXITED, "RUNNING", 0, false),
+		state(listener.PROCESS_STATE_BACKOFF, "STARTING", 1, false),
+		state(listener.PROCESS_STATE_FATAL, "BACKOFF", 0, false),
+		state(listener.PROCESS_STATE_STOPPING, "RUNNING", 0, false),
+		state(listener.PROCESS_STATE_STOPPED, "STOPPING", 0, false),
+		state(listener.PROCESS_STATE_UNKNOWN, "RUNNING", 0, false),
+		{Event: listener.PROCESS_GROUP_ADDED, Payload: ProcessGroupPayload("api")},
+		{Event: listener.PROCESS_GROUP_REMOVED, Payload: ProcessGroupPayload("api")},
+		{Event: listener.EVENT_BUFFER_OVERFLOW, Payload: EventBufferOverflowPayload(listener.EventBufferOverflow{GroupName: "listener", EventType: "ProcessStateExitedEvent"})},
+		{Event: listener.SUPERVISOR_STATE_CHANGE_STOPPING},
+	}
+}
+
+// RunSuite sends the steps in order. It stops at the first protocol
+// violation.
+func (s *Supervisord) RunSuite(steps []Step) *Report {
+	report := new(Report)
+	for i, step := range steps {
+		result, err := s.Send(step.Event, step.Payload)
+		if errors.Is(err, ErrBlocked) {
+			head := s.pending[0].Header
+			report.Unexpected = append(report.Unexpected, fmt.Sprintf("step %d (%s): not delivered, %s event %d failed again", i+1, step.Event, head.EventName, head.Serial))
+			continue
+		}
+		if err != nil {
+			report.Err = fmt.Errorf("step %d (%s): %w", i+1, step.Event, err)
+			break
+		}
+		if step.Expect != "" && result != step.Expect {
+			report.Unexpected = append(report.Unexpected, fmt.Sprintf("step %d (%s): got %s, want %s", i+1, step.Event, string(result), string(step.Expect)))
+		}
+	}
+	report.Deliveries = s.History()
+	return report
+}
+
+// Spawn starts cmd the way supervisord starts an event listener, with the
+// SUPERVISOR_* environment variables set and its stdin and stdout
+// connected to the returned Supervisord. The process is named after the
+// executable. The variables replace those inherited from the current
+// process, but may be overridden in cmd.Env. Closing the
+// Supervisord closes the process's stdin and waits for it to exit, killing
+// it after the Timeout.
+func Spawn(cmd *exec.Cmd, serverURL string) (*Supervisord, error) {
+	name := filepath.Base(cmd.Path)
+	vars := []string{
+		"SUPERVISOR_ENABLED=1",
+		"SUPERVISOR_PROCESS_NAME=" + name,
+		"SUPERVISOR_GROUP_NAME=" + name,
+		"SUPERVISOR_SERVER_URL=" + serverURL,
+	}
+	//later entries win
+	if cmd.Env == nil {
+		cmd.Env = append(os.Environ(), vars...)
+	} else {
+		cmd.Env = append(vars, cmd.Env...)
+	}
+
+	//own pipes, since exec closes those of StdoutPipe when the process exits
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+
+	cmd.Stdin, cmd.Stdout = inR, outW
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, err
+	}
+
+	s := New(outR, inW)
+	s.done = make(chan error, 1)
+	s.kill = func() {
+		cmd.Process.Kill()
+	}
+	go func() {
+		s.done <- cmd.Wait()
+	}()
+	return s, nil
+}
@@ -0,0 +1,137 @@
+package listenertest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is not a real test; it is run by spawn as an event
+// listener behaving according to LISTENERTEST_HELPER.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("LISTENERTEST_HELPER")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	if mode == "listener" {
+		attempts := make(map[int]int)
+		l := listener.NewListener(nil, nil, listener.HandlerFunc(func(e *listener.Event) listener.Result {
+			//the Listener sends stray output to stderr
+			fmt.Println("handling", e.Header.EventName)
+			if os.Getenv("SUPERVISOR_ENABLED") != "1" || os.Getenv("SUPERVISOR_SERVER_URL") != helperServerURL {
+				return listener.RESULT_FAIL
+			}
+
+			//log events succeed on the third attempt
+			if e.Header.EventType().Is(listener.PROCESS_LOG) {
+				attempts[e.Header.Serial]++
+				if attempts[e.Header.Serial] < 3 {
+					return listener.RESULT_FAIL
+				}
+			}
+			return listener.RESULT_OK
+		}))
+		l.Run()
+		return
+	}
+
+	//hand-written listeners with protocol errors
+	r := bufio.NewReader(os.Stdin)
+	for {
+		if mode == "noready" {
+			time.Sleep(time.Second)
+			return
+		}
+		os.Stdout.WriteString("READY\n")
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		n, _ := strconv.Atoi(strings.TrimPrefix(fields[len(fields)-1], "len:"))
+		io.CopyN(io.Discard, r, int64(n))
+
+		switch mode {
+		case "stray":
+			os.Stdout.WriteString("debug: got event\n")
+		case "malformed":
+			os.Stdout.WriteString("RESULT OK\n")
+		}
+		os.Stdout.WriteString("RESULT 2\nOK")
+	}
+}
+
+const helperServerURL = "http://127.0.0.1:9001"
+
+func spawn(t *testing.T, mode string) *Supervisord {
+	//the helper inherits the environment, including a stale server URL
+	t.Setenv("LISTENERTEST_HELPER", mode)
+	t.Setenv("SUPERVISOR_SERVER_URL", "http://127.0.0.1:1")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	s, err := Spawn(cmd, helperServerURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Timeout = 2 * time.Second
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	suite := DefaultSuite()
+	for i := range suite {
+		suite[i].Expect = listener.RESULT_OK
+	}
+
+	s := spawn(t, "listener")
+	report := s.RunSuite(suite)
+	assert.NoError(t, report.Err)
+	assert.Equal(t, []string{
+		"step 4 (PROCESS_LOG_STDOUT): got FAIL, want OK",
+		"step 5 (PROCESS_LOG_STDERR): not delivered, PROCESS_LOG_STDOUT event 3 failed again",
+		"step 6 (PROCESS_COMMUNICATION_STDOUT): not delivered, PROCESS_LOG_STDERR event 4 failed again",
+		"step 7 (REMOTE_COMMUNICATION): not delivered, PROCESS_LOG_STDERR event 4 failed again",
+	}, report.Unexpected)
+	assert.False(t, report.OK())
+	//each log event is sent three times, the queued events once
+	assert.Len(t, report.Deliveries, len(suite)+4)
+	assert.Empty(t, s.Pending())
+	assert.NoError(t, s.Close())
+}
+
+func TestConformanceViolations(t *testing.T) {
+	var perr *ProtocolError
+
+	s := spawn(t, "stray")
+	report := s.RunSuite(DefaultSuite())
+	if assert.True(t, errors.As(report.Err, &perr)) {
+		assert.Equal(t, "debug: got event\n", perr.Output)
+	}
+	s.Close()
+
+	s = spawn(t, "malformed")
+	report = s.RunSuite(DefaultSuite())
+	if assert.True(t, errors.As(report.Err, &perr)) {
+		assert.Equal(t, "RESULT OK\n", perr.Output)
+	}
+	s.Close()
+
+	s = spawn(t, "noready")
+	s.Timeout = 100 * time.Millisecond
+	report = s.RunSuite(DefaultSuite())
+	assert.True(t, errors.Is(report.Err, ErrTimeout))
+	assert.Empty(t, report.Deliveries)
+	s.Close()
+}
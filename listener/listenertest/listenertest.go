@@ -0,0 +1,384 @@
+// Package listenertest emulates supervisord's side of the event listener
+// protocol, so listeners can be tested without running supervisord:
+//
+//	s := listenertest.Start(l)
+//	defer s.Close()
+//	s.Expect(t, listener.TICK_5, listenertest.TickPayload(5), listener.RESULT_OK)
+//
+// Like supervisord, the harness waits for READY before sending an event,
+// numbers events with serials and pool serials, and sends events the
+// listener rejected with FAIL again, with the same serials, before any new
+// event. While a failed event keeps failing, new events queue up behind it
+// instead of being sent. Output supervisord would not accept fails the
+// harness with a *ProtocolError.
+package listenertest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("timed out")
+	ErrClosed  = errors.New("listener closed its output")
+	ErrBlocked = errors.New("blocked by a failed event")
+)
+
+// ProtocolError reports output of the listener that supervisord would not
+// accept.
+type ProtocolError struct {
+	// Expected describes what supervisord was waiting for.
+	Expected string
+
+	// Output is the unexpected output.
+	Output string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("listenertest: expected %s, got %q", e.Expected, e.Output)
+}
+
+// Delivery is an event sent to the listener and its answer.
+type Delivery struct {
+	Header  listener.Header
+	Payload string
+	Result  listener.Result
+}
+
+// token is a READY or RESULT sent by the listener, or output that is
+// neither, which is marked invalid.
+type token struct {
+	ready   bool
+	result  string
+	raw     string
+	invalid bool
+	err     error
+}
+
+// Supervisord is the supervisord end of a listener's protocol streams.
+type Supervisord struct {
+	// Server and Pool are sent in event headers, "supervisor" and
+	// "listener" if empty.
+	Server string
+	Pool   string
+
+	// Serial and PoolSerial are the serials of the next new event. They
+	// may be changed between events, e.g. to emulate a supervisord
+	// restart.
+	Serial     int
+	PoolSerial int
+
+	// Timeout limits the wait for READY and RESULT, 5 seconds if zero.
+	Timeout time.Duration
+
+	w       io.Writer
+	tokens  chan token
+	closing chan struct{}
+	once    sync.Once
+
+	ready   bool
+	err     error
+	pending []Delivery
+	history []Delivery
+
+	//set by Start and Spawn
+	done chan error
+	kill func()
+}
+
+// New returns a Supervisord reading the listener's output from r and
+// writing events to w.
+func New(r io.Reader, w io.Writer) *Supervisord {
+	s := &Supervisord{
+		w:       w,
+		tokens:  make(chan token),
+		closing: make(chan struct{}),
+	}
+	go s.read(r)
+	return s
+}
+
+// Start runs l with its In and Out connected to a new Supervisord.
+func Start(l *listener.Listener) *Supervisord {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	l.In, l.Out = inR, outW
+
+	s := New(outR, inW)
+	s.done = make(chan error, 1)
+	go func() {
+		err := l.Run()
+		inR.Close()
+		outW.Close()
+		s.done <- err
+	}()
+	return s
+}
+
+func (s *Supervisord) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 5 * time.Second
+}
+
+// read passes the listener's output to the goroutine waiting for it.
+// After the first problem, or once the Supervisord is closed, the output
+// is discarded so the listener never blocks writing it.
+func (s *Supervisord) read(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		tok := readToken(br)
+		select {
+		case s.tokens <- tok:
+		case <-s.closing:
+		}
+		if tok.err != nil || tok.invalid {
+			io.Copy(io.Discard, br)
+			return
+		}
+	}
+}
+
+func readToken(r *bufio.Reader) (tok token) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		tok.err = ErrClosed
+		return
+	}
+	if err != nil && err != io.EOF {
+		tok.err = err
+		return
+	}
+
+	tok.raw = line
+	if line == "READY\n" {
+		tok.ready = true
+		return
+	}
+
+	//RESULT <len>\n<body>
+	tok.invalid = true
+	if !strings.HasPrefix(line, "RESULT ") || !strings.HasSuffix(line, "\n") {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "RESULT "), "\n"))
+	if err != nil || n < 0 || n > 64 {
+		return
+	}
+
+	body := make([]byte, n)
+	read, _ := io.ReadFull(r, body)
+	tok.result = string(body[:read])
+	tok.raw += tok.result
+	tok.invalid = read < n || (tok.result != string(listener.RESULT_OK) && tok.result != string(listener.RESULT_FAIL))
+	return
+}
+
+// next waits for the listener's next token.
+func (s *Supervisord) next(expected string) (token, error) {
+	select {
+	case tok := <-s.tokens:
+		if tok.err != nil {
+			return tok, fmt.Errorf("listenertest: waiting for %s: %w", expected, tok.err)
+		}
+		return tok, nil
+	case <-time.After(s.timeout()):
+		return token{}, fmt.Errorf("listenertest: waiting for %s: %w", expected, ErrTimeout)
+	}
+}
+
+// WaitReady waits until the listener is ready for an event.
+func (s *Supervisord) WaitReady() error {
+	if s.err != nil || s.ready {
+		return s.err
+	}
+
+	tok, err := s.next("READY")
+	if err == nil && !tok.ready {
+		err = &ProtocolError{Expected: "READY", Output: tok.raw}
+	}
+	if err != nil {
+		s.err = err
+		return err
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *Supervisord) write(data string) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(s.w, data)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.timeout()):
+		return fmt.Errorf("listenertest: writing event: %w", ErrTimeout)
+	}
+}
+
+// deliver sends an event once and waits for its result.
+func (s *Supervisord) deliver(d Delivery) (Delivery, error) {
+	if err := s.WaitReady(); err != nil {
+		return d, err
+	}
+
+	d.Header.Len = len(d.Payload)
+	if err := s.write(d.Header.String() + "\n" + d.Payload); err != nil {
+		s.err = err
+		return d, err
+	}
+	s.ready = false
+
+	tok, err := s.next("RESULT")
+	if err == nil && (tok.invalid || tok.ready) {
+		err = &ProtocolError{Expected: "RESULT with OK or FAIL", Output: tok.raw}
+	}
+	if err != nil {
+		s.err = err
+		return d, err
+	}
+
+	d.Result = listener.Result(tok.result)
+	s.history = append(s.history, d)
+	return d, nil
+}
+
+// Redeliver sends the pending events once more, in order, and returns the
+// deliveries. Like supervisord, which puts a failed event back at the head
+// of its buffer, it stops at the first event failing again; that event and
+// the ones queued behind it stay pending.
+func (s *Supervisord) Redeliver() ([]Delivery, error) {
+	pending := s.pending
+	s.pending = nil
+
+	var deliveries []Delivery
+	for i, p := range pending {
+		d, err := s.deliver(p)
+		if err != nil {
+			s.pending = pending[i:]
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+		if d.Result == listener.RESULT_FAIL {
+			s.pending = pending[i:]
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+// Send sends a new event of type t and returns the listener's result.
+// Pending events are redelivered first, as supervisord does; their results
+// are found in History. A failed event is kept for redelivery. If a
+// redelivery fails again, the new event is not sent: it is queued behind
+// the failed one and Send returns an error wrapping ErrBlocked.
+func (s *Supervisord) Send(t listener.EventType, payload string) (listener.Result, error) {
+	if _, err := s.Redeliver(); err != nil {
+		return "", err
+	}
+
+	server, pool := s.Server, s.Pool
+	if server == "" {
+		server = "supervisor"
+	}
+	if pool == "" {
+		pool = "listener"
+	}
+
+	d := Delivery{
+		Header: listener.Header{
+			Version:    listener.ProtocolVersion,
+			Server:     server,
+			Serial:     s.Serial,
+			Pool:       pool,
+			PoolSerial: s.PoolSerial,
+			EventName:  string(t),
+		},
+		Payload: payload,
+	}
+	s.Serial++
+	s.PoolSerial++
+
+	if len(s.pending) > 0 {
+		head := s.pending[0].Header
+		s.pending = append(s.pending, d)
+		return "", fmt.Errorf("listenertest: %s event: %w, %s event %d failed again", t, ErrBlocked, head.EventName, head.Serial)
+	}
+
+	d, err := s.deliver(d)
+	if err != nil {
+		return "", err
+	}
+	if d.Result == listener.RESULT_FAIL {
+		s.pending = append(s.pending, d)
+	}
+	return d.Result, nil
+}
+
+// Expect sends a new event and fails the test if it can't be delivered or
+// the result is not want.
+func (s *Supervisord) Expect(t testing.TB, et listener.EventType, payload string, want listener.Result) {
+	t.Helper()
+
+	got, err := s.Send(et, payload)
+	if err != nil {
+		t.Fatalf("%s event: %v", et, err)
+	}
+	if got != want {
+		t.Errorf("%s event: got %s, want %s", et, string(got), string(want))
+	}
+}
+
+// Pending returns the events waiting to be sent: the failed event first,
+// followed by the events queued behind it.
+func (s *Supervisord) Pending() []Delivery {
+	return append([]Delivery(nil), s.pending...)
+}
+
+// History returns all deliveries, including redeliveries, in order.
+func (s *Supervisord) History() []Delivery {
+	return append([]Delivery(nil), s.history...)
+}
+
+// Close closes the listener's input, which makes a Listener's Run return.
+// For a Supervisord created by Start or Spawn, it waits for the listener to
+// exit and returns the error of Run or of the process.
+func (s *Supervisord) Close() (err error) {
+	s.once.Do(func() {
+		close(s.closing)
+		if c, ok := s.w.(io.Closer); ok {
+			err = c.Close()
+		}
+		if s.done == nil {
+			return
+		}
+
+		select {
+		case err = <-s.done:
+		case <-time.After(s.timeout()):
+			err = fmt.Errorf("listenertest: waiting for the listener to exit: %w", ErrTimeout)
+			if s.kill != nil {
+				s.kill()
+				<-s.done
+			}
+		}
+	})
+	return
+}
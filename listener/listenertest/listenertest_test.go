@@ -0,0 +1,160 @@
+package listenertest
+
+import (
+	"errors"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newListener(h listener.HandlerFunc) *listener.Listener {
+	l := listener.NewListener(nil, nil, h)
+	l.Logger = log.New(io.Discard, "", 0)
+	return l
+}
+
+func TestSupervisord(t *testing.T) {
+	var states []listener.ProcessStateEvent
+	attempts := 0
+	l := newListener(func(e *listener.Event) listener.Result {
+		switch p := e.Payload.(type) {
+		case listener.ProcessStateEvent:
+			states = append(states, p)
+		case listener.ProcessLog:
+			//fail the first attempt only
+			attempts++
+			if attempts == 1 {
+				return listener.RESULT_FAIL
+			}
+		}
+		return listener.RESULT_OK
+	})
+
+	s := Start(l)
+	s.Serial = 20
+
+	s.Expect(t, listener.PROCESS_STATE_EXITED, ProcessStatePayload(listener.PROCESS_STATE_EXITED, listener.ProcessState{
+		ProcessName: "web_0", GroupName: "web", FromState: "RUNNING", Pid: 42,
+	}), listener.RESULT_OK)
+	if assert.Len(t, states, 1) {
+		assert.Equal(t, 42, states[0].Pid)
+		assert.False(t, states[0].Expected)
+	}
+
+	s.Expect(t, listener.PROCESS_LOG_STDOUT, ProcessLogPayload(listener.ProcessLog{ProcessName: "web_0", GroupName: "web", Data: "hi"}), listener.RESULT_FAIL)
+	assert.Len(t, s.Pending(), 1)
+
+	//the failed event is redelivered before the next one
+	s.Expect(t, listener.TICK_5, TickPayload(5), listener.RESULT_OK)
+	assert.Empty(t, s.Pending())
+	assert.NoError(t, s.Close())
+
+	history := s.History()
+	if assert.Len(t, history, 4) {
+		assert.Equal(t, 20, history[0].Header.Serial)
+		assert.Equal(t, 0, history[0].Header.PoolSerial)
+
+		assert.Equal(t, listener.RESULT_FAIL, history[1].Result)
+		assert.Equal(t, history[1].Header, history[2].Header)
+		assert.Equal(t, listener.RESULT_OK, history[2].Result)
+
+		assert.Equal(t, "TICK_5", history[3].Header.EventName)
+		assert.Equal(t, 22, history[3].Header.Serial)
+		assert.Equal(t, 2, history[3].Header.PoolSerial)
+		assert.Equal(t, 6, history[3].Header.Len)
+	}
+}
+
+func TestSupervisordBlocked(t *testing.T) {
+	var healthy int32
+	l := newListener(func(e *listener.Event) listener.Result {
+		if e.Header.EventType().Is(listener.PROCESS_LOG) && atomic.LoadInt32(&healthy) == 0 {
+			return listener.RESULT_FAIL
+		}
+		return listener.RESULT_OK
+	})
+
+	s := Start(l)
+	s.Expect(t, listener.PROCESS_LOG_STDOUT, ProcessLogPayload(listener.ProcessLog{ProcessName: "web_0", GroupName: "web", Data: "hi"}), listener.RESULT_FAIL)
+
+	//the redelivery fails again, so the new event waits behind it
+	_, err := s.Send(listener.TICK_5, TickPayload(5))
+	assert.True(t, errors.Is(err, ErrBlocked))
+	pending := s.Pending()
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, "PROCESS_LOG_STDOUT", pending[0].Header.EventName)
+		assert.Equal(t, "TICK_5", pending[1].Header.EventName)
+		assert.Equal(t, 1, pending[1].Header.Serial)
+	}
+	assert.Len(t, s.History(), 2)
+
+	atomic.StoreInt32(&healthy, 1)
+	deliveries, err := s.Redeliver()
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, listener.RESULT_OK, deliveries[0].Result)
+		assert.Equal(t, "TICK_5", deliveries[1].Header.EventName)
+	}
+	assert.Empty(t, s.Pending())
+
+	s.Expect(t, listener.TICK_5, TickPayload(10), listener.RESULT_OK)
+	assert.NoError(t, s.Close())
+	assert.Len(t, s.History(), 5)
+}
+
+func TestStrayOutput(t *testing.T) {
+	var l *listener.Listener
+	l = newListener(func(e *listener.Event) listener.Result {
+		io.WriteString(l.Out, "handling event\n")
+		return listener.RESULT_OK
+	})
+
+	s := Start(l)
+	_, err := s.Send(listener.TICK_5, TickPayload(5))
+
+	var perr *ProtocolError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "handling event\n", perr.Output)
+	}
+
+	//the harness stays failed
+	_, err = s.Send(listener.TICK_5, TickPayload(10))
+	assert.Error(t, err)
+	assert.NoError(t, s.Close())
+}
+
+func TestMalformedOutput(t *testing.T) {
+	for _, output := range []string{"", "READY\nREADY\n", "READY\nRESULT 4\nGOOD", "READY\nRESULT x\n", "READY\nRESULT 3\nOK"} {
+		r, w := io.Pipe()
+		s := New(strings.NewReader(output), w)
+		s.Timeout = 50 * time.Millisecond
+		go io.Copy(io.Discard, r)
+
+		_, err := s.Send(listener.TICK_5, TickPayload(5))
+		assert.Error(t, err, "%q", output)
+		s.Close()
+	}
+
+	//no READY at all
+	r, w := io.Pipe()
+	defer w.Close()
+	s := New(r, io.Discard)
+	s.Timeout = 10 * time.Millisecond
+	assert.True(t, errors.Is(s.WaitReady(), ErrTimeout))
+}
+
+func TestPayloads(t *testing.T) {
+	assert.Equal(t, "processname:a groupname:b from_state:STARTING tries:2",
+		ProcessStatePayload(listener.PROCESS_STATE_BACKOFF, listener.ProcessState{ProcessName: "a", GroupName: "b", FromState: "STARTING", Tries: 2}))
+	assert.Equal(t, "processname:a groupname:b from_state:RUNNING expected:1 pid:7",
+		ProcessStatePayload(listener.PROCESS_STATE_EXITED, listener.ProcessState{ProcessName: "a", GroupName: "b", FromState: "RUNNING", Expected: true, Pid: 7}))
+	assert.Equal(t, "processname:a groupname:b from_state:BACKOFF",
+		ProcessStatePayload(listener.PROCESS_STATE_FATAL, listener.ProcessState{ProcessName: "a", GroupName: "b", FromState: "BACKOFF"}))
+	assert.Equal(t, "groupname:listener event_type:ProcessStateExitedEvent",
+		EventBufferOverflowPayload(listener.EventBufferOverflow{GroupName: "listener", EventType: "ProcessStateExitedEvent"}))
+}
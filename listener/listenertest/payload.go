@@ -0,0 +1,60 @@
+package listenertest
+
+import (
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+)
+
+// ProcessStatePayload returns the payload supervisord sends for a
+// PROCESS_STATE event of type t, including only the tokens it sends for
+// that state.
+func ProcessStatePayload(t listener.EventType, ps listener.ProcessState) string {
+	payload := fmt.Sprintf("processname:%s groupname:%s from_state:%s", ps.ProcessName, ps.GroupName, ps.FromState)
+
+	switch t {
+	case listener.PROCESS_STATE_STARTING, listener.PROCESS_STATE_BACKOFF:
+		payload += fmt.Sprintf(" tries:%d", ps.Tries)
+	case listener.PROCESS_STATE_RUNNING, listener.PROCESS_STATE_STOPPING, listener.PROCESS_STATE_STOPPED:
+		payload += fmt.Sprintf(" pid:%d", ps.Pid)
+	case listener.PROCESS_STATE_EXITED:
+		expected := 0
+		if ps.Expected {
+			expected = 1
+		}
+		payload += fmt.Sprintf(" expected:%d pid:%d", expected, ps.Pid)
+	}
+	return payload
+}
+
+// ProcessLogPayload returns the payload of a PROCESS_LOG event.
+func ProcessLogPayload(pl listener.ProcessLog) string {
+	return fmt.Sprintf("processname:%s groupname:%s pid:%d\n%s", pl.ProcessName, pl.GroupName, pl.Pid, pl.Data)
+}
+
+// ProcessCommunicationPayload returns the payload of a
+// PROCESS_COMMUNICATION event.
+func ProcessCommunicationPayload(pc listener.ProcessCommunication) string {
+	return fmt.Sprintf("processname:%s groupname:%s pid:%d\n%s", pc.ProcessName, pc.GroupName, pc.Pid, pc.Data)
+}
+
+// RemoteCommunicationPayload returns the payload of a REMOTE_COMMUNICATION
+// event.
+func RemoteCommunicationPayload(rc listener.RemoteCommunication) string {
+	return fmt.Sprintf("type:%s\n%s", rc.Type, rc.Data)
+}
+
+// ProcessGroupPayload returns the payload of a PROCESS_GROUP event.
+func ProcessGroupPayload(group string) string {
+	return "groupname:" + group
+}
+
+// EventBufferOverflowPayload returns the payload of an
+// EVENT_BUFFER_OVERFLOW event.
+func EventBufferOverflowPayload(ebo listener.EventBufferOverflow) string {
+	return fmt.Sprintf("groupname:%s event_type:%s", ebo.GroupName, ebo.EventType)
+}
+
+// TickPayload returns the payload of a TICK event.
+func TickPayload(when int) string {
+	return fmt.Sprintf("when:%d", when)
+}
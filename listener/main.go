@@ -2,10 +2,11 @@ package listener
 
 import (
 	"bufio"
-	"fmt"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"io"
 	"log"
 	"os"
-	"strings"
+	"time"
 )
 
 const (
@@ -14,89 +15,359 @@ const (
 	ProcessLogPrefix            = "PROCESS_LOG"
 	SupervisorStateChangePrefix = "SUPERVISOR_STATE_CHANGE"
 	TickPrefix                  = "TICK"
+	ProcessCommunicationPrefix  = "PROCESS_COMMUNICATION"
+	ProcessGroupPrefix          = "PROCESS_GROUP"
+	EventBufferOverflowPrefix   = "EVENT_BUFFER_OVERFLOW"
 )
 
 type ProcessStateHandler interface {
-	handleProcessState(Header, ProcessState) Result
+	HandleProcessState(Header, ProcessState) Result
 }
 
 type ProcessStateHandlerFunc func(Header, ProcessState) Result
 
-func (p ProcessStateHandlerFunc) handleProcessState(h Header, ps ProcessState) Result {
+func (p ProcessStateHandlerFunc) HandleProcessState(h Header, ps ProcessState) Result {
 	return p(h, ps)
 }
 
 type RemoteCommunicationHandler interface {
-	handleRemoteCommunication(Header, RemoteCommunication) Result
+	HandleRemoteCommunication(Header, RemoteCommunication) Result
+}
+
+type RemoteCommunicationHandlerFunc func(Header, RemoteCommunication) Result
+
+func (r RemoteCommunicationHandlerFunc) HandleRemoteCommunication(h Header, rc RemoteCommunication) Result {
+	return r(h, rc)
 }
 
 type ProcessLogHandler interface {
+	HandleProcessLog(Header, ProcessLog) Result
+}
+
+type ProcessLogHandlerFunc func(Header, ProcessLog) Result
+
+func (p ProcessLogHandlerFunc) HandleProcessLog(h Header, pl ProcessLog) Result {
+	return p(h, pl)
 }
 
 type SupervisorStateChangeHandler interface {
+	HandleSupervisorStateChange(Header, SupervisorStateChange) Result
+}
+
+type SupervisorStateChangeHandlerFunc func(Header, SupervisorStateChange) Result
+
+func (s SupervisorStateChangeHandlerFunc) HandleSupervisorStateChange(h Header, sc SupervisorStateChange) Result {
+	return s(h, sc)
 }
 
 type TickHandler interface {
+	HandleTick(Header, Tick) Result
+}
+
+type TickHandlerFunc func(Header, Tick) Result
+
+func (t TickHandlerFunc) HandleTick(h Header, tick Tick) Result {
+	return t(h, tick)
+}
+
+type ProcessCommunicationHandler interface {
+	HandleProcessCommunication(Header, ProcessCommunication) Result
+}
+
+type ProcessCommunicationHandlerFunc func(Header, ProcessCommunication) Result
+
+func (p ProcessCommunicationHandlerFunc) HandleProcessCommunication(h Header, pc ProcessCommunication) Result {
+	return p(h, pc)
+}
+
+type ProcessGroupHandler interface {
+	HandleProcessGroup(Header, ProcessGroup) Result
+}
+
+type ProcessGroupHandlerFunc func(Header, ProcessGroup) Result
+
+func (p ProcessGroupHandlerFunc) HandleProcessGroup(h Header, pg ProcessGroup) Result {
+	return p(h, pg)
+}
+
+type EventBufferOverflowHandler interface {
+	HandleEventBufferOverflow(Header, EventBufferOverflow) Result
 }
 
+type EventBufferOverflowHandlerFunc func(Header, EventBufferOverflow) Result
+
+func (e EventBufferOverflowHandlerFunc) HandleEventBufferOverflow(h Header, ebo EventBufferOverflow) Result {
+	return e(h, ebo)
+}
+
+// Listener reads events from supervisord and passes them to Handler. If
+// Handler is nil, events are dispatched to the typed handlers embedded in
+// the Listener instead.
 type Listener struct {
 	ProcessStateHandler
 	RemoteCommunicationHandler
+	ProcessLogHandler
+	SupervisorStateChangeHandler
+	TickHandler
+	ProcessCommunicationHandler
+	ProcessGroupHandler
+	EventBufferOverflowHandler
+
+	Handler Handler
+
+	// Supervisor is attached to every event, if set.
+	Supervisor supervisor.Supervisor
+
+	// In and Out carry the event listener protocol. They default to the
+	// standard input and output of the process; see Run for how stdout is
+	// kept free of other output then.
+	In  io.Reader
+	Out io.Writer
+
+	// Logger receives diagnostics. If nil, they are written to stderr.
+	Logger *log.Logger
+
+	// MaxPayloadLen limits the size of event payloads; larger events stop
+	// Run with a *ProtocolError. Defaults to DefaultMaxPayloadLen.
+	MaxPayloadLen int
+
+	// Timeout limits the time a handler may take. When it expires, the
+	// event's context is cancelled and TimeoutResult is returned to
+	// supervisord without waiting for the handler any longer. The handler
+	// keeps running until it returns, so it may still be handling the event
+	// when supervisord delivers it again after a RESULT_FAIL.
+	Timeout time.Duration
+
+	// TimeoutResult is the result of timed out events, RESULT_FAIL if empty.
+	TimeoutResult Result
+
+	// MaxAbandoned limits the number of timed out handlers still running.
+	// Beyond that, a timed out handler is waited for and its result is
+	// returned. DefaultMaxAbandoned if zero; if negative, handlers are
+	// always waited for.
+	MaxAbandoned int
+
+	// QueueSize enables acknowledge-then-process mode if positive: events
+	// are acknowledged as soon as they are queued and handled by Workers
+	// goroutines afterwards. Results of the handlers are only logged. An
+	// event arriving while the queue is full fails, so supervisord delivers
+	// it again later.
+	QueueSize int
+
+	// Workers is the number of goroutines handling queued events, 1 if not
+	// set. With more than one, events may be handled out of order.
+	Workers int
+
+	// Recorder, if set, records every event received.
+	Recorder *Recorder
+
+	// Serials, if set, tracks the events processed. Events supervisord
+	// delivers again after they were processed are acknowledged without
+	// passing them to the handler.
+	Serials *SerialTracker
+
+	abandoned int32
+}
+
+// NewListener returns a Listener speaking the protocol over in and out,
+// passing events to h.
+func NewListener(in io.Reader, out io.Writer, h Handler) *Listener {
+	return &Listener{In: in, Out: out, Handler: h}
+}
+
+// protocolWriter writes the tokens sent to supervisord.
+type protocolWriter struct {
+	w io.Writer
+}
+
+func (p *protocolWriter) write(token string) error {
+	_, err := io.WriteString(p.w, token)
+	return err
+}
+
+func (p *protocolWriter) ready() error {
+	return p.write("READY\n")
 }
 
+func (p *protocolWriter) result(r Result) error {
+	return p.write(r.String())
+}
+
+func (l *Listener) logf(format string, v ...interface{}) {
+	if l.Logger != nil {
+		l.Logger.Printf(format, v...)
+		return
+	}
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, v...)
+}
+
+// Run processes events until the input is closed between two events,
+// which is not considered an error. Input violating the protocol stops Run
+// with a *ProtocolError.
+//
+// If Out is nil, the protocol is written to a private copy of the standard
+// output and file descriptor 1 is pointed at stderr until Run returns, so
+// anything handlers print, e.g. with fmt.Println, goes to stderr instead of
+// corrupting the protocol. Where that is not supported, handlers must not
+// write to stdout.
 func (l *Listener) Run() error {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Println("READY")
+	in := l.In
+	if in == nil {
+		in = os.Stdin
+	}
 
-		//read string until end of line
-		line, err := reader.ReadString('\n')
+	out := l.Out
+	if out == nil {
+		stdout, restore, err := isolateStdout()
 		if err != nil {
-			log.Println(err)
+			l.logf("Failed to isolate stdout, handler output may corrupt the protocol: %v", err)
+			stdout = os.Stdout
+		} else {
+			defer restore()
+		}
+		out = stdout
+	}
+
+	maxPayloadLen := l.MaxPayloadLen
+	if maxPayloadLen <= 0 {
+		maxPayloadLen = DefaultMaxPayloadLen
+	}
+
+	var queue chan *Event
+	if l.QueueSize > 0 {
+		var wait func()
+		queue, wait = l.startWorkers()
+		defer func() {
+			close(queue)
+			wait()
+		}()
+	}
+
+	protocol := &protocolWriter{w: out}
+	reader := bufio.NewReader(in)
+	for {
+		if err := protocol.ready(); err != nil {
+			l.logf("Failed to write READY: %v", err)
 			return err
 		}
 
-		//parse header line
-		hdr, err := parseHeader(line)
+		hdr, payload, err := readEvent(reader, maxPayloadLen)
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Println(err)
+			l.logf("%v", err)
 			return err
 		}
 
-		//read payload
-		payload := make([]byte, hdr.Len)
-		n, err := reader.Read(payload)
-		if err != nil || n != len(payload) {
-			log.Printf("Failed to read %d bytes from payload (n=%d, err=%v)", hdr.Len, n, err)
-			break
+		if l.Recorder != nil {
+			if err := l.Recorder.Record(hdr, payload); err != nil {
+				l.logf("Failed to record %s event %d: %v", hdr.EventName, hdr.Serial, err)
+			}
 		}
 
-		fmt.Print(l.handle(hdr, payload))
+		var result Result
+		switch {
+		case l.Serials != nil && l.Serials.Check(hdr, payload):
+			l.logf("Skipping %s event %d, it was processed before", hdr.EventName, hdr.Serial)
+			result = RESULT_OK
+		case queue != nil:
+			result = l.enqueue(queue, hdr, payload)
+			l.processed(hdr, payload, result)
+		default:
+			result = l.handle(hdr, payload)
+			l.processed(hdr, payload, result)
+		}
+
+		if err := protocol.result(result); err != nil {
+			l.logf("Failed to write result: %v", err)
+			return err
+		}
 	}
 
-	log.Printf("Exiting reader loop")
+	l.logf("Exiting reader loop")
 
 	return nil
 }
 
+// processed records a successfully handled event with l.Serials.
+func (l *Listener) processed(h Header, payload []byte, result Result) {
+	if l.Serials == nil || result != RESULT_OK {
+		return
+	}
+	if err := l.Serials.Done(h, payload); err != nil {
+		l.logf("Failed to save serials of %s event %d: %v", h.EventName, h.Serial, err)
+	}
+}
+
+// typedHandlers returns a Router for the typed handlers embedded in l.
+func (l *Listener) typedHandlers() *Router {
+	r := NewRouter()
+	if l.ProcessStateHandler != nil {
+		r.Handle(ProcessStatePrefix, ProcessStateHandlerFunc(l.HandleProcessState))
+	}
+	if l.RemoteCommunicationHandler != nil {
+		r.Handle(RemoteCommunicationPrefix, RemoteCommunicationHandlerFunc(l.HandleRemoteCommunication))
+	}
+	if l.ProcessLogHandler != nil {
+		r.Handle(ProcessLogPrefix, ProcessLogHandlerFunc(l.HandleProcessLog))
+	}
+	if l.SupervisorStateChangeHandler != nil {
+		r.Handle(SupervisorStateChangePrefix, SupervisorStateChangeHandlerFunc(l.HandleSupervisorStateChange))
+	}
+	if l.TickHandler != nil {
+		r.Handle(TickPrefix, TickHandlerFunc(l.HandleTick))
+	}
+	if l.ProcessCommunicationHandler != nil {
+		r.Handle(ProcessCommunicationPrefix, ProcessCommunicationHandlerFunc(l.HandleProcessCommunication))
+	}
+	if l.ProcessGroupHandler != nil {
+		r.Handle(ProcessGroupPrefix, ProcessGroupHandlerFunc(l.HandleProcessGroup))
+	}
+	if l.EventBufferOverflowHandler != nil {
+		r.Handle(EventBufferOverflowPrefix, EventBufferOverflowHandlerFunc(l.HandleEventBufferOverflow))
+	}
+	return r
+}
+
+// event parses a payload into the Event passed to handlers.
+func (l *Listener) event(h Header, payload []byte) (*Event, error) {
+	parsed, err := parseEvent(h, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Header:     h,
+		Raw:        payload,
+		Payload:    parsed,
+		Supervisor: l.Supervisor,
+	}, nil
+}
+
+func (l *Listener) handler() Handler {
+	if l.Handler != nil {
+		return l.Handler
+	}
+	return l.typedHandlers()
+}
+
 func (l *Listener) handle(h Header, payload []byte) Result {
-	if strings.HasPrefix(h.EventName, ProcessStatePrefix) && l.ProcessStateHandler != nil {
-		ps, err := parseProcessState(string(payload))
-		if err != nil {
-			//FIXME: should probably bail out here because supervisor will re-queue this event
-			// this might end up being an infinite loop
-			return RESULT_FAIL
+	handler := l.handler()
+	if r, ok := handler.(*Router); ok {
+		//events nobody handles are acknowledged without parsing them
+		if handler = r.Handler(h.EventType()); handler == nil {
+			return RESULT_OK
 		}
-		return l.ProcessStateHandler.handleProcessState(h, ps)
-	} else if strings.HasPrefix(h.EventName, RemoteCommunicationPrefix) {
-		//TODO: implement
-	} else if strings.HasPrefix(h.EventName, ProcessLogPrefix) {
-		//TODO: implement
-	} else if strings.HasPrefix(h.EventName, SupervisorStateChangePrefix) {
-		//TODO: implement
-	} else if strings.HasPrefix(h.EventName, TickPrefix) {
-		//TODO: implement
-	}
-
-	return RESULT_OK
+	}
+
+	e, err := l.event(h, payload)
+	if err != nil {
+		//a payload that can't be parsed fails the event, which makes supervisor re-queue it
+		//FIXME: this might end up being an infinite loop
+		l.logf("Failed to parse %s event %d: %v", h.EventName, h.Serial, err)
+		return RESULT_FAIL
+	}
+
+	return l.invoke(handler, e)
 }
@@ -0,0 +1,131 @@
+package listener
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestListenerHandle(t *testing.T) {
+	var tick Tick
+	var pl ProcessLog
+	var rc RemoteCommunication
+	var sc SupervisorStateChange
+
+	l := &Listener{
+		TickHandler: TickHandlerFunc(func(h Header, t Tick) Result {
+			tick = t
+			return RESULT_OK
+		}),
+		ProcessLogHandler: ProcessLogHandlerFunc(func(h Header, p ProcessLog) Result {
+			pl = p
+			return RESULT_OK
+		}),
+		RemoteCommunicationHandler: RemoteCommunicationHandlerFunc(func(h Header, r RemoteCommunication) Result {
+			rc = r
+			return RESULT_FAIL
+		}),
+		SupervisorStateChangeHandler: SupervisorStateChangeHandlerFunc(func(h Header, s SupervisorStateChange) Result {
+			sc = s
+			return RESULT_OK
+		}),
+		Logger: log.New(io.Discard, "", 0),
+	}
+
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "TICK_60"}, []byte("when:60")))
+	assert.Equal(t, 60, tick.When)
+
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "PROCESS_LOG_STDOUT"}, []byte("processname:a groupname:b pid:1\nhello")))
+	assert.Equal(t, "hello", pl.Data)
+	assert.Equal(t, "stdout", pl.Channel)
+
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "REMOTE_COMMUNICATION"}, []byte("type:x\ny")))
+	assert.Equal(t, "x", rc.Type)
+
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "SUPERVISOR_STATE_CHANGE_STOPPING"}, nil))
+	assert.Equal(t, "STOPPING", sc.State)
+
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "TICK_5"}, []byte("garbage")))
+
+	var group ProcessGroup
+	l.ProcessGroupHandler = ProcessGroupHandlerFunc(func(h Header, pg ProcessGroup) Result {
+		group = pg
+		return RESULT_OK
+	})
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "PROCESS_GROUP_REMOVED"}, []byte("groupname:cat")))
+	assert.Equal(t, "cat", group.GroupName)
+
+	//events without a handler are acknowledged
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "PROCESS_STATE_RUNNING"}, []byte("garbage")))
+}
+
+func TestListenerRun(t *testing.T) {
+	in := strings.NewReader(
+		"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6\nwhen:5" +
+			"ver:3.0 server:supervisor serial:2 pool:listener poolserial:2 eventname:TICK_5 len:7\ngarbage")
+	var out bytes.Buffer
+	var logged bytes.Buffer
+
+	var ticks []int
+	l := NewListener(in, &out, TickHandlerFunc(func(h Header, tick Tick) Result {
+		ticks = append(ticks, tick.When)
+		return RESULT_OK
+	}))
+	l.Logger = log.New(&logged, "", 0)
+
+	assert.NoError(t, l.Run())
+	assert.Equal(t, []int{5}, ticks)
+	assert.Equal(t, "READY\nRESULT 2\nOKREADY\nRESULT 4\nFAILREADY\n", out.String())
+	assert.Equal(t, "Failed to parse TICK_5 event 2: Malformed token data\nExiting reader loop\n", logged.String())
+}
+
+// redirectFd points file descriptor fd at a pipe until the returned
+// function is called, which returns everything written to it.
+func redirectFd(t *testing.T, fd int) func() string {
+	saved, err := dup(fd)
+	if err != nil {
+		t.Skip(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dup2(int(w.Fd()), fd); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() string {
+		dup2(saved, fd)
+		os.NewFile(uintptr(saved), "").Close()
+		w.Close()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		return string(data)
+	}
+}
+
+func TestListenerRunStdout(t *testing.T) {
+	stdout := redirectFd(t, 1)
+	stderr := redirectFd(t, 2)
+
+	in := strings.NewReader("ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6\nwhen:5")
+	l := NewListener(in, nil, HandlerFunc(func(e *Event) Result {
+		//handler output must not end up in the protocol stream
+		fmt.Println("handling", e.Header.EventName)
+		return RESULT_OK
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+	err := l.Run()
+	fmt.Println("after Run")
+
+	errOutput := stderr()
+	output := stdout()
+	assert.NoError(t, err)
+	assert.Equal(t, "READY\nRESULT 2\nOKREADY\nafter Run\n", output)
+	assert.Equal(t, "handling TICK_5\n", errOutput)
+}
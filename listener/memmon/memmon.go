@@ -0,0 +1,197 @@
+// Package memmon implements an event listener restarting processes that
+// use too much memory, similar to superlance's memmon.
+//
+// The Monitor checks the processes on every TICK event it receives and
+// needs a Supervisor attached to the listener:
+//
+//	[eventlistener:memmon]
+//	command=memmon -p web=200MB
+//	events=TICK_60
+//
+// A restart waits for the process to stop and start again, which can take
+// stopwaitsecs plus startsecs. Run the Listener with QueueSize set, so
+// events are acknowledged while a restart is in progress instead of piling
+// up in supervisord's buffer for the pool.
+package memmon
+
+import (
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/config"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/state"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Restart describes a process exceeding its limit.
+type Restart struct {
+	// Name is the full process name, group:name.
+	Name string
+	Pid  int64
+
+	// RSS is the memory used by the process and its children.
+	RSS   config.ByteSize
+	Limit config.ByteSize
+
+	Time time.Time
+
+	// DryRun is set if the process was not actually restarted.
+	DryRun bool
+
+	// Err is the error restarting the process, if any.
+	Err error
+}
+
+// Monitor is a listener.Handler restarting processes whose resident memory,
+// including that of their child processes, exceeds a limit.
+type Monitor struct {
+	// Programs holds limits by process name or group:name. Groups holds
+	// limits applying to every process of a group and Any applies to all
+	// other processes; zero means no limit. The most specific limit wins.
+	Programs map[string]config.ByteSize
+	Groups   map[string]config.ByteSize
+	Any      config.ByteSize
+
+	// Cooldown is the minimum time between two restarts of a process,
+	// measured in tick time.
+	Cooldown time.Duration
+
+	// DryRun reports processes exceeding their limit without restarting
+	// them. The cooldown applies to the reports as well.
+	DryRun bool
+
+	// Notify is called for every process exceeding its limit, after it
+	// was restarted.
+	Notify func(Restart)
+
+	// ProcRoot is the procfs mount, /proc if empty.
+	ProcRoot string
+
+	// Logger receives diagnostics. If nil, they are written to stderr.
+	Logger *log.Logger
+
+	mu          sync.Mutex
+	lastRestart map[string]time.Time
+}
+
+func (m *Monitor) logf(format string, v ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Printf(format, v...)
+		return
+	}
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, v...)
+}
+
+// limit returns the limit applying to a process, or 0.
+func (m *Monitor) limit(info supervisor.ProcessInfo) config.ByteSize {
+	if limit, ok := m.Programs[info.Group+":"+info.Name]; ok {
+		return limit
+	}
+	if limit, ok := m.Programs[info.Name]; ok {
+		return limit
+	}
+	if limit, ok := m.Groups[info.Group]; ok {
+		return limit
+	}
+	return m.Any
+}
+
+// HandleEvent checks all processes on TICK events. Problems talking to
+// supervisord or reading /proc are logged; the event is always
+// acknowledged, as retrying a stale tick is pointless.
+func (m *Monitor) HandleEvent(e *listener.Event) listener.Result {
+	tick, ok := e.Payload.(listener.Tick)
+	if !ok {
+		return listener.RESULT_OK
+	}
+	if e.Supervisor == nil {
+		m.logf("memmon: no supervisor attached to the listener")
+		return listener.RESULT_OK
+	}
+
+	if _, err := m.Check(e.Supervisor, time.Unix(int64(tick.When), 0)); err != nil {
+		m.logf("memmon: %v", err)
+	}
+	return listener.RESULT_OK
+}
+
+// Check compares the memory usage of all running processes against their
+// limits at time now and restarts the offenders. It returns the processes
+// found exceeding their limit and not in their cooldown period.
+func (m *Monitor) Check(s supervisor.Supervisor, now time.Time) ([]Restart, error) {
+	infos, err := s.GetAllProcessInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	root := m.ProcRoot
+	if root == "" {
+		root = "/proc"
+	}
+	procs, err := newProcTable(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var restarts []Restart
+	for _, info := range infos {
+		limit := m.limit(info)
+		if limit <= 0 || info.State != state.RUNNING || info.Pid <= 0 {
+			continue
+		}
+
+		rss, err := procs.totalRSS(info.Pid)
+		if err != nil {
+			m.logf("memmon: %s:%s: %v", info.Group, info.Name, err)
+			continue
+		}
+		if config.ByteSize(rss) <= limit {
+			continue
+		}
+
+		name := info.Group + ":" + info.Name
+		if !m.reserve(name, now) {
+			continue
+		}
+
+		r := Restart{Name: name, Pid: info.Pid, RSS: config.ByteSize(rss), Limit: limit, Time: now, DryRun: m.DryRun}
+		if !m.DryRun {
+			r.Err = restart(s, name)
+		}
+		if r.Err != nil {
+			m.logf("memmon: failed to restart %s: %v", name, r.Err)
+		}
+		if m.Notify != nil {
+			m.Notify(r)
+		}
+		restarts = append(restarts, r)
+	}
+	return restarts, nil
+}
+
+// reserve records a restart of name at now unless the process is in its
+// cooldown period. The restart itself happens without holding m.mu, since
+// it can take stopwaitsecs plus startsecs.
+func (m *Monitor) reserve(name string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastRestart == nil {
+		m.lastRestart = make(map[string]time.Time)
+	}
+	if last, ok := m.lastRestart[name]; ok && now.Sub(last) < m.Cooldown {
+		return false
+	}
+	m.lastRestart[name] = now
+	return true
+}
+
+func restart(s supervisor.Supervisor, name string) error {
+	if _, err := s.StopProcess(name, true); err != nil {
+		return err
+	}
+	_, err := s.StartProcess(name, true)
+	return err
+}
@@ -0,0 +1,165 @@
+package memmon
+
+import (
+	"errors"
+	"fmt"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"github.com/Ligustah/go-supervisor/config"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/Ligustah/go-supervisor/state"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeSupervisor struct {
+	supervisor.Supervisor
+	infos []supervisor.ProcessInfo
+	calls []string
+}
+
+func (f *fakeSupervisor) GetAllProcessInfo() ([]supervisor.ProcessInfo, error) {
+	return f.infos, nil
+}
+
+func (f *fakeSupervisor) StopProcess(name string, wait bool) (bool, error) {
+	f.calls = append(f.calls, "stop "+name)
+	return true, nil
+}
+
+func (f *fakeSupervisor) StartProcess(name string, wait bool) (bool, error) {
+	f.calls = append(f.calls, "start "+name)
+	if name == "db:db" {
+		return false, errors.New("SPAWN_ERROR")
+	}
+	return true, nil
+}
+
+// writeProc creates the stat and status files of a fake process.
+func writeProc(t *testing.T, root string, pid, ppid int64, rssKB int64) {
+	dir := filepath.Join(root, strconv.FormatInt(pid, 10))
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+
+	stat := fmt.Sprintf("%d (my (odd) proc) S %d %d 0 0", pid, ppid, pid)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644))
+
+	status := fmt.Sprintf("Name:\tproc\nState:\tS (sleeping)\nVmRSS:\t  %d kB\nThreads:\t1\n", rssKB)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644))
+}
+
+func TestMonitor(t *testing.T) {
+	root := t.TempDir()
+	writeProc(t, root, 1, 0, 1000)
+	writeProc(t, root, 100, 1, 50*1024)   //web_0
+	writeProc(t, root, 101, 100, 60*1024) //child of web_0
+	writeProc(t, root, 102, 101, 10*1024) //grandchild of web_0
+	writeProc(t, root, 200, 1, 80*1024)   //web_1
+	writeProc(t, root, 300, 1, 300*1024)  //db
+	writeProc(t, root, 400, 1, 900*1024)  //worker, stopped
+
+	s := &fakeSupervisor{infos: []supervisor.ProcessInfo{
+		{Name: "web_0", Group: "web", Pid: 100, State: state.RUNNING},
+		{Name: "web_1", Group: "web", Pid: 200, State: state.RUNNING},
+		{Name: "db", Group: "db", Pid: 300, State: state.RUNNING},
+		{Name: "worker", Group: "worker", Pid: 400, State: state.STOPPED},
+	}}
+
+	var notified []Restart
+	m := &Monitor{
+		Programs: map[string]config.ByteSize{"db:db": 200 * config.MB},
+		Groups:   map[string]config.ByteSize{"web": 100 * config.MB},
+		Any:      10 * config.MB,
+		Cooldown: time.Minute,
+		ProcRoot: root,
+		Notify:   func(r Restart) { notified = append(notified, r) },
+		Logger:   log.New(io.Discard, "", 0),
+	}
+
+	restarts, err := m.Check(s, time.Unix(1000, 0))
+	assert.NoError(t, err)
+	if assert.Len(t, restarts, 2) {
+		assert.Equal(t, "web:web_0", restarts[0].Name)
+		assert.Equal(t, 120*config.MB, restarts[0].RSS)
+		assert.Equal(t, 100*config.MB, restarts[0].Limit)
+		assert.NoError(t, restarts[0].Err)
+
+		assert.Equal(t, "db:db", restarts[1].Name)
+		assert.EqualError(t, restarts[1].Err, "SPAWN_ERROR")
+	}
+	assert.Equal(t, restarts, notified)
+	assert.Equal(t, []string{"stop web:web_0", "start web:web_0", "stop db:db", "start db:db"}, s.calls)
+
+	//within the cooldown period nothing is restarted
+	s.calls = nil
+	result := m.HandleEvent(&listener.Event{
+		Header:     listener.Header{EventName: "TICK_5"},
+		Payload:    listener.Tick{When: 1030},
+		Supervisor: s,
+	})
+	assert.Equal(t, listener.RESULT_OK, result)
+	assert.Empty(t, s.calls)
+
+	restarts, err = m.Check(s, time.Unix(1060, 0))
+	assert.NoError(t, err)
+	assert.Len(t, restarts, 2)
+}
+
+func TestMonitorDryRun(t *testing.T) {
+	root := t.TempDir()
+	writeProc(t, root, 100, 1, 50*1024)
+
+	s := &fakeSupervisor{infos: []supervisor.ProcessInfo{{Name: "web", Group: "web", Pid: 100, State: state.RUNNING}}}
+	m := &Monitor{Programs: map[string]config.ByteSize{"web": config.MB}, DryRun: true, ProcRoot: root}
+
+	restarts, err := m.Check(s, time.Unix(1000, 0))
+	assert.NoError(t, err)
+	if assert.Len(t, restarts, 1) {
+		assert.True(t, restarts[0].DryRun)
+	}
+	assert.Empty(t, s.calls)
+}
+
+// slowSupervisor blocks in StopProcess until released.
+type slowSupervisor struct {
+	fakeSupervisor
+	stopping chan struct{}
+	release  chan struct{}
+}
+
+func (s *slowSupervisor) StopProcess(name string, wait bool) (bool, error) {
+	s.stopping <- struct{}{}
+	<-s.release
+	return true, nil
+}
+
+func TestMonitorConcurrentCheck(t *testing.T) {
+	root := t.TempDir()
+	writeProc(t, root, 100, 1, 50*1024)
+
+	s := &slowSupervisor{
+		fakeSupervisor: fakeSupervisor{infos: []supervisor.ProcessInfo{{Name: "web_0", Group: "web", Pid: 100, State: state.RUNNING}}},
+		stopping:       make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	m := &Monitor{Any: 10 * config.MB, Cooldown: time.Minute, ProcRoot: root, Logger: log.New(io.Discard, "", 0)}
+
+	done := make(chan []Restart)
+	go func() {
+		restarts, _ := m.Check(s, time.Unix(1000, 0))
+		done <- restarts
+	}()
+	<-s.stopping
+
+	//a check during the restart neither waits for it nor restarts again
+	restarts, err := m.Check(s, time.Unix(1001, 0))
+	assert.NoError(t, err)
+	assert.Empty(t, restarts)
+
+	close(s.release)
+	assert.Len(t, <-done, 1)
+}
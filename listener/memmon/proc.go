@@ -0,0 +1,101 @@
+package memmon
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procTable reads process information from a procfs mount.
+type procTable struct {
+	root     string
+	children map[int64][]int64
+}
+
+func newProcTable(root string) (*procTable, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &procTable{root: root, children: make(map[int64][]int64)}
+	for _, entry := range entries {
+		pid, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		//processes may exit while we look at them
+		ppid, err := t.parent(pid)
+		if err != nil {
+			continue
+		}
+		t.children[ppid] = append(t.children[ppid], pid)
+	}
+	return t, nil
+}
+
+// parent returns the parent pid from /proc/<pid>/stat. The command name in
+// the second field is in parentheses and may contain spaces or
+// parentheses itself, so parsing starts after the last one.
+func (t *procTable) parent(pid int64) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(t.root, strconv.FormatInt(pid, 10), "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	stat := string(data)
+	idx := strings.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	return strconv.ParseInt(fields[1], 10, 64)
+}
+
+// rss returns the resident set size of a single process in bytes.
+func (t *procTable) rss(pid int64) (int64, error) {
+	f, err := os.Open(filepath.Join(t.root, strconv.FormatInt(pid, 10), "status"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	//kernel threads and zombies have no VmRSS
+	return 0, nil
+}
+
+// totalRSS returns the resident set size of pid and all its descendants.
+func (t *procTable) totalRSS(pid int64) (int64, error) {
+	total, err := t.rss(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, child := range t.children[pid] {
+		//ignore children exiting in the meantime
+		if rss, err := t.totalRSS(child); err == nil {
+			total += rss
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,234 @@
+package listener
+
+import (
+	"log"
+	"os"
+	"path"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps a Handler to add behaviour around it, like net/http
+// middleware.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in middleware. The first middleware is the outermost, so
+// Chain(h, Logging(nil), Recover(nil)) logs the result of the recovered
+// handler.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+func printf(logger *log.Logger, format string, v ...interface{}) {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	logger.Printf(format, v...)
+}
+
+// Logging logs every event with its result and the time it took to
+// handle. If logger is nil, the log is written to stderr.
+func Logging(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(e *Event) Result {
+			start := time.Now()
+			result := next.HandleEvent(e)
+			printf(logger, "%s event %d: %s in %v", e.Header.EventName, e.Header.Serial, string(result), time.Since(start))
+			return result
+		})
+	}
+}
+
+// Recover turns panics into RESULT_FAIL, logging them with a stack trace.
+// The Listener recovers from panics by itself; Recover is useful for
+// handlers combined with All, where a panic would skip the others. If
+// logger is nil, the log is written to stderr.
+func Recover(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(e *Event) (result Result) {
+			defer func() {
+				if r := recover(); r != nil {
+					printf(logger, "Handler for %s event %d panicked: %v\n%s", e.Header.EventName, e.Header.Serial, r, debug.Stack())
+					result = RESULT_FAIL
+				}
+			}()
+			return next.HandleEvent(e)
+		})
+	}
+}
+
+// Stats are the counters kept by Metrics for an event type.
+type Stats struct {
+	Events int64
+	Failed int64
+
+	// Total and Max are the summed and the longest handling time.
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Metrics counts events and their outcome and measures handling latency
+// per event type. Panics are not counted, so Recover should be placed
+// inside Metrics.
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[EventType]*Stats
+}
+
+// Middleware is the Middleware collecting the metrics.
+func (m *Metrics) Middleware(next Handler) Handler {
+	return HandlerFunc(func(e *Event) Result {
+		start := time.Now()
+		result := next.HandleEvent(e)
+		m.observe(e.Header.EventType(), result, time.Since(start))
+		return result
+	})
+}
+
+func (m *Metrics) observe(t EventType, result Result, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats == nil {
+		m.stats = make(map[EventType]*Stats)
+	}
+	s := m.stats[t]
+	if s == nil {
+		s = new(Stats)
+		m.stats[t] = s
+	}
+
+	s.Events++
+	if result != RESULT_OK {
+		s.Failed++
+	}
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// Stats returns a copy of the counters of t, or the sum over all event
+// types if t is empty.
+func (m *Metrics) Stats(t EventType) (stats Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for et, s := range m.stats {
+		if t != "" && et != t {
+			continue
+		}
+		stats.Events += s.Events
+		stats.Failed += s.Failed
+		stats.Total += s.Total
+		if s.Max > stats.Max {
+			stats.Max = s.Max
+		}
+	}
+	return
+}
+
+// EventTypes returns the event types seen so far, sorted.
+func (m *Metrics) EventTypes() []EventType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	types := make([]EventType, 0, len(m.stats))
+	for t := range m.stats {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// names returns the process and group an event concerns. Process is empty
+// for events concerning a group only; ok is false for events concerning
+// neither.
+func names(payload interface{}) (process, group string, ok bool) {
+	switch p := payload.(type) {
+	case ProcessStateEvent:
+		return p.ProcessName, p.GroupName, true
+	case ProcessLog:
+		return p.ProcessName, p.GroupName, true
+	case ProcessCommunication:
+		return p.ProcessName, p.GroupName, true
+	case ProcessGroup:
+		return "", p.GroupName, true
+	}
+	return "", "", false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterProcess passes on events concerning a process matching one of
+// patterns and acknowledges other process events without handling them.
+// Patterns use path.Match syntax and are matched against the process name,
+// or against group:process if they contain a colon. Events not concerning
+// a process are passed on.
+func FilterProcess(patterns ...string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(e *Event) Result {
+			process, group, ok := names(e.Payload)
+			if !ok || process == "" {
+				return next.HandleEvent(e)
+			}
+			for _, pattern := range patterns {
+				name := process
+				if strings.Contains(pattern, ":") {
+					name = group + ":" + process
+				}
+				if ok, _ := path.Match(pattern, name); ok {
+					return next.HandleEvent(e)
+				}
+			}
+			return RESULT_OK
+		})
+	}
+}
+
+// FilterGroup passes on events concerning a group matching one of
+// patterns, which use path.Match syntax, and acknowledges other process
+// and group events without handling them. Events not concerning a process
+// or group are passed on.
+func FilterGroup(patterns ...string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(e *Event) Result {
+			if _, group, ok := names(e.Payload); ok && !matchAny(patterns, group) {
+				return RESULT_OK
+			}
+			return next.HandleEvent(e)
+		})
+	}
+}
+
+// Sample passes on every nth event, starting with the first, and
+// acknowledges the others without handling them. Values below 2 pass on
+// every event.
+func Sample(n int) Middleware {
+	return func(next Handler) Handler {
+		if n < 2 {
+			return next
+		}
+		var count uint64
+		return HandlerFunc(func(e *Event) Result {
+			if (atomic.AddUint64(&count, 1)-1)%uint64(n) != 0 {
+				return RESULT_OK
+			}
+			return next.HandleEvent(e)
+		})
+	}
+}
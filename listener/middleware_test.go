@@ -0,0 +1,110 @@
+package listener
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+)
+
+func processEvent(group, process string) *Event {
+	return &Event{
+		Header:  Header{EventName: "PROCESS_STATE_EXITED", Serial: 3},
+		Payload: ProcessStateEvent{ProcessState: ProcessState{ProcessName: process, GroupName: group}},
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(e *Event) Result {
+				order = append(order, name)
+				return next.HandleEvent(e)
+			})
+		}
+	}
+
+	h := Chain(HandlerFunc(func(e *Event) Result {
+		order = append(order, "handler")
+		return RESULT_OK
+	}), mw("outer"), mw("inner"))
+
+	assert.Equal(t, RESULT_OK, h.HandleEvent(&Event{}))
+	assert.Equal(t, []string{"outer", "inner", "handler"}, order)
+}
+
+func TestLoggingRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	h := Chain(HandlerFunc(func(e *Event) Result {
+		panic("boom")
+	}), Logging(logger), Recover(logger))
+
+	assert.Equal(t, RESULT_FAIL, h.HandleEvent(processEvent("web", "web_0")))
+	assert.Contains(t, buf.String(), "Handler for PROCESS_STATE_EXITED event 3 panicked: boom")
+	assert.Contains(t, buf.String(), "PROCESS_STATE_EXITED event 3: FAIL in ")
+}
+
+func TestMetrics(t *testing.T) {
+	m := &Metrics{}
+	h := Chain(HandlerFunc(func(e *Event) Result {
+		if _, ok := e.Payload.(Tick); ok {
+			return RESULT_OK
+		}
+		return RESULT_FAIL
+	}), m.Middleware)
+
+	h.HandleEvent(processEvent("web", "web_0"))
+	h.HandleEvent(&Event{Header: Header{EventName: "TICK_5"}, Payload: Tick{When: 5}})
+	h.HandleEvent(&Event{Header: Header{EventName: "TICK_5"}, Payload: Tick{When: 10}})
+
+	assert.Equal(t, []EventType{PROCESS_STATE_EXITED, TICK_5}, m.EventTypes())
+
+	tick := m.Stats(TICK_5)
+	assert.Equal(t, int64(2), tick.Events)
+	assert.Equal(t, int64(0), tick.Failed)
+
+	all := m.Stats("")
+	assert.Equal(t, int64(3), all.Events)
+	assert.Equal(t, int64(1), all.Failed)
+	assert.True(t, all.Max <= all.Total)
+}
+
+func TestFilters(t *testing.T) {
+	var handled []string
+	record := HandlerFunc(func(e *Event) Result {
+		handled = append(handled, e.Header.EventName)
+		return RESULT_FAIL
+	})
+	tick := &Event{Header: Header{EventName: "TICK_5"}, Payload: Tick{When: 5}}
+
+	byProcess := Chain(record, FilterProcess("web_*", "db:primary"))
+	assert.Equal(t, RESULT_FAIL, byProcess.HandleEvent(processEvent("web", "web_0")))
+	assert.Equal(t, RESULT_FAIL, byProcess.HandleEvent(processEvent("db", "primary")))
+	assert.Equal(t, RESULT_OK, byProcess.HandleEvent(processEvent("cache", "primary")))
+	assert.Equal(t, RESULT_OK, byProcess.HandleEvent(processEvent("api", "api_0")))
+	assert.Equal(t, RESULT_FAIL, byProcess.HandleEvent(tick))
+
+	byGroup := Chain(record, FilterGroup("web"))
+	assert.Equal(t, RESULT_FAIL, byGroup.HandleEvent(processEvent("web", "web_1")))
+	assert.Equal(t, RESULT_OK, byGroup.HandleEvent(processEvent("api", "web_1")))
+	assert.Equal(t, RESULT_OK, byGroup.HandleEvent(&Event{Header: Header{EventName: "PROCESS_GROUP_ADDED"}, Payload: ProcessGroup{GroupName: "api"}}))
+	assert.Equal(t, RESULT_FAIL, byGroup.HandleEvent(tick))
+
+	assert.Len(t, handled, 5)
+}
+
+func TestSample(t *testing.T) {
+	count := 0
+	h := Chain(HandlerFunc(func(e *Event) Result {
+		count++
+		return RESULT_OK
+	}), Sample(3))
+
+	for i := 0; i < 7; i++ {
+		h.HandleEvent(&Event{})
+	}
+	assert.Equal(t, 3, count)
+}
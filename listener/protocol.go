@@ -1,9 +1,13 @@
 package listener
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"github.com/Ligustah/go-supervisor/state"
 	"github.com/mitchellh/mapstructure"
+	"io"
+	"reflect"
 	"strings"
 )
 
@@ -17,6 +21,13 @@ type Header struct {
 	Len        int
 }
 
+// String returns the header line as sent by supervisord, without the
+// trailing newline.
+func (h Header) String() string {
+	return fmt.Sprintf("ver:%s server:%s serial:%d pool:%s poolserial:%d eventname:%s len:%d",
+		h.Version, h.Server, h.Serial, h.Pool, h.PoolSerial, h.EventName, h.Len)
+}
+
 type ProcessState struct {
 	ProcessName string
 	GroupName   string
@@ -26,17 +37,55 @@ type ProcessState struct {
 	Tries       int
 }
 
+// ProcessStateEvent is the payload of PROCESS_STATE events. From and To
+// are state codes as defined in the state package; To is only part of the
+// event name.
+type ProcessStateEvent struct {
+	ProcessState
+	From int64
+	To   int64
+}
+
 type ProcessLog struct {
 	ProcessName string
 	GroupName   string
 	Pid         int
-	Data        string
+	Channel     string `mapstructure:"-"`
+	Data        string `mapstructure:"-"`
 }
 
 type RemoteCommunication struct {
+	Type string
+	Data string `mapstructure:"-"`
 }
 
+type SupervisorStateChange struct {
+	State string
+}
+
+// ProcessCommunication is the payload of PROCESS_COMMUNICATION events,
+// sent when a process writes data enclosed in the capture mode tags to
+// stdout or stderr. Data is the content between the tags.
 type ProcessCommunication struct {
+	ProcessName string
+	GroupName   string
+	Pid         int
+	Channel     string `mapstructure:"-"`
+	Data        string `mapstructure:"-"`
+}
+
+// ProcessGroup is the payload of PROCESS_GROUP_ADDED and
+// PROCESS_GROUP_REMOVED events.
+type ProcessGroup struct {
+	GroupName string
+}
+
+// EventBufferOverflow is the payload of EVENT_BUFFER_OVERFLOW events, sent
+// when events for the listener pool GroupName had to be discarded.
+// EventType is the class name of the discarded event.
+type EventBufferOverflow struct {
+	GroupName string
+	EventType string `mapstructure:"event_type"`
 }
 
 type Tick struct {
@@ -54,17 +103,78 @@ func (r Result) String() string {
 	return fmt.Sprintf("RESULT %d\n%s", len(string(r)), string(r))
 }
 
-func parseTokenData(data string, into interface{}) (err error) {
+// tokenKeys returns the token keys of the struct pointed to by into: the
+// mapstructure tag of a field or its lower-cased name.
+func tokenKeys(into interface{}) (keys []string) {
+	t := reflect.TypeOf(into).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		switch tag := t.Field(i).Tag.Get("mapstructure"); tag {
+		case "-":
+		case "":
+			keys = append(keys, strings.ToLower(t.Field(i).Name))
+		default:
+			keys = append(keys, tag)
+		}
+	}
+	return
+}
+
+func isTokenSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// keyAt returns the length of key: if one of keys starts a token at
+// data[i], or 0.
+func keyAt(data string, i int, keys []string) int {
+	if i > 0 && !isTokenSpace(data[i-1]) {
+		return 0
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(data[i:], key+":") {
+			return len(key) + 1
+		}
+	}
+	return 0
+}
+
+// splitTokens splits key:value tokens separated by whitespace. Only keys
+// start a token, so values may contain whitespace and colons; the
+// whitespace between tokens is not part of the values. The first token may
+// have any key.
+func splitTokens(data string, keys []string) (map[string]string, error) {
 	m := make(map[string]string)
-	tuples := strings.Split(strings.TrimSpace(data), " ")
-	for _, tuple := range tuples {
-		keyValue := strings.SplitN(tuple, ":", 2)
-		if len(keyValue) != 2 {
-			err = errors.New("Malformed token data")
-			return
+	data = strings.TrimLeft(data, " \t\r\n")
+	if data == "" {
+		return m, nil
+	}
+
+	n := keyAt(data, 0, keys)
+	if n == 0 {
+		//an unknown first key
+		n = strings.IndexByte(data, ':') + 1
+		if n <= 1 || strings.ContainsAny(data[:n], " \t\r\n") {
+			return nil, errors.New("Malformed token data")
+		}
+	}
+
+	for start := 0; start < len(data); {
+		key := data[start : start+n-1]
+		end, next := start+n, 0
+		for ; end < len(data); end++ {
+			if next = keyAt(data, end, keys); next > 0 {
+				break
+			}
 		}
+		m[key] = strings.TrimRight(data[start+n:end], " \t\r\n")
+		start, n = end, next
+	}
+	return m, nil
+}
 
-		m[keyValue[0]] = keyValue[1]
+func parseTokenData(data string, into interface{}) (err error) {
+	m, err := splitTokens(data, tokenKeys(into))
+	if err != nil {
+		return
 	}
 
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -86,12 +196,215 @@ func parseProcessState(data string) (ps ProcessState, err error) {
 	return
 }
 
+func parseProcessStateEvent(t EventType, data string) (pse ProcessStateEvent, err error) {
+	if pse.ProcessState, err = parseProcessState(data); err != nil {
+		return
+	}
+
+	//unknown state names map to state.UNKNOWN
+	pse.From, _ = state.Code(pse.FromState)
+	pse.To, _ = state.Code(t.suffix())
+	return
+}
+
+// splitPayload separates the token line of a payload from the data that
+// follows it.
+func splitPayload(data string) (tokens, body string) {
+	if idx := strings.IndexByte(data, '\n'); idx >= 0 {
+		return data[:idx], data[idx+1:]
+	}
+	return data, ""
+}
+
+// eventSuffix returns the part of eventName following prefix and an
+// underscore, e.g. STDOUT for PROCESS_LOG_STDOUT.
+func eventSuffix(eventName, prefix string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(eventName, prefix), "_")
+}
+
+func parseProcessLog(t EventType, data string) (pl ProcessLog, err error) {
+	tokens, body := splitPayload(data)
+	if err = parseTokenData(tokens, &pl); err != nil {
+		return
+	}
+
+	pl.Channel = strings.ToLower(t.suffix())
+	pl.Data = body
+	return
+}
+
+func parseProcessCommunication(t EventType, data string) (pc ProcessCommunication, err error) {
+	tokens, body := splitPayload(data)
+	if err = parseTokenData(tokens, &pc); err != nil {
+		return
+	}
+
+	pc.Channel = strings.ToLower(t.suffix())
+	pc.Data = body
+	return
+}
+
+func parseProcessGroup(data string) (pg ProcessGroup, err error) {
+	err = parseTokenData(data, &pg)
+	return
+}
+
+func parseEventBufferOverflow(data string) (ebo EventBufferOverflow, err error) {
+	err = parseTokenData(data, &ebo)
+	return
+}
+
+func parseRemoteCommunication(data string) (rc RemoteCommunication, err error) {
+	tokens, body := splitPayload(data)
+	if err = parseTokenData(tokens, &rc); err != nil {
+		return
+	}
+
+	rc.Data = body
+	return
+}
+
+func parseSupervisorStateChange(t EventType) SupervisorStateChange {
+	return SupervisorStateChange{State: t.suffix()}
+}
+
 func parseTick(data string) (t Tick, err error) {
 	err = parseTokenData(data, &t)
 	return
 }
 
+// parseEvent decodes payload into the structure matching the event type.
+// Events without a known structure result in a nil payload.
+func parseEvent(h Header, payload []byte) (interface{}, error) {
+	data := string(payload)
+	t := h.EventType()
+
+	switch {
+	case t.Is(PROCESS_STATE):
+		return parseProcessStateEvent(t, data)
+	case t.Is(REMOTE_COMMUNICATION):
+		return parseRemoteCommunication(data)
+	case t.Is(PROCESS_LOG):
+		return parseProcessLog(t, data)
+	case t.Is(SUPERVISOR_STATE_CHANGE):
+		return parseSupervisorStateChange(t), nil
+	case t.Is(TICK):
+		return parseTick(data)
+	case t.Is(PROCESS_COMMUNICATION):
+		return parseProcessCommunication(t, data)
+	case t.Is(PROCESS_GROUP):
+		return parseProcessGroup(data)
+	case t.Is(EVENT_BUFFER_OVERFLOW):
+		return parseEventBufferOverflow(data)
+	}
+
+	return nil, nil
+}
+
+// ProtocolVersion is the event listener protocol version supported.
+const ProtocolVersion = "3.0"
+
+var headerTokens = []string{"ver", "server", "serial", "pool", "poolserial", "eventname", "len"}
+
 func parseHeader(line string) (hdr Header, err error) {
-	err = parseTokenData(line, &hdr)
+	tokens, err := splitTokens(line, headerTokens)
+	if err != nil {
+		return
+	}
+	for _, key := range headerTokens {
+		if _, ok := tokens[key]; !ok {
+			err = fmt.Errorf("Malformed header: missing %s", key)
+			return
+		}
+	}
+
+	if err = parseTokenData(line, &hdr); err != nil {
+		return
+	}
+
+	switch {
+	case hdr.Version != ProtocolVersion:
+		err = fmt.Errorf("Unsupported protocol version %q", hdr.Version)
+	case hdr.EventName == "":
+		err = errors.New("Malformed header: empty eventname")
+	case hdr.Len < 0:
+		err = fmt.Errorf("Malformed header: negative len %d", hdr.Len)
+	}
 	return
 }
+
+// ProtocolError reports input from supervisord that does not follow the
+// event listener protocol.
+type ProtocolError struct {
+	// Op is the step that failed: "header" or "payload".
+	Op string
+
+	// Header is the header line, if it has been read.
+	Header string
+
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("listener protocol: %s: %v", e.Op, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrHeaderTooLong   = errors.New("header line too long")
+	ErrPayloadTooLarge = errors.New("payload too large")
+)
+
+const (
+	// MaxHeaderLen limits the length of a header line.
+	MaxHeaderLen = 4096
+
+	// DefaultMaxPayloadLen is used when a Listener has no MaxPayloadLen.
+	DefaultMaxPayloadLen = 16 * 1024 * 1024
+)
+
+// readEvent reads a header line and the payload it announces. It returns
+// io.EOF if the input ends before a header, and a *ProtocolError for
+// anything else that is not a complete event.
+func readEvent(r *bufio.Reader, maxPayloadLen int) (hdr Header, payload []byte, err error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MaxHeaderLen {
+			return hdr, nil, &ProtocolError{"header", "", ErrHeaderTooLong}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) == 0 {
+			return hdr, nil, io.EOF
+		}
+		if err == io.EOF {
+			return hdr, nil, &ProtocolError{"header", string(line), io.ErrUnexpectedEOF}
+		}
+		if err != nil {
+			return hdr, nil, err
+		}
+		break
+	}
+
+	if hdr, err = parseHeader(string(line)); err != nil {
+		return hdr, nil, &ProtocolError{"header", string(line), err}
+	}
+	if hdr.Len > maxPayloadLen {
+		return hdr, nil, &ProtocolError{"payload", string(line), fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, hdr.Len)}
+	}
+
+	payload = make([]byte, hdr.Len)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return hdr, nil, &ProtocolError{"payload", string(line), err}
+	}
+	return hdr, payload, nil
+}
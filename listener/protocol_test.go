@@ -1,10 +1,21 @@
 package listener
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/Ligustah/go-supervisor/state"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
 func TestParseHeader(t *testing.T) {
 	testInput := "ver:3.0 server:supervisor serial:21 pool:listener poolserial:10 eventname:PROCESS_COMMUNICATION_STDOUT len:54"
 	hdr, err := parseHeader(testInput)
@@ -31,3 +42,221 @@ func TestParseProcessState(t *testing.T) {
 	assert.Equal(t, true, ps.Expected)
 	assert.Equal(t, 2456, ps.Pid)
 }
+
+func TestParseProcessLog(t *testing.T) {
+	testInput := "processname:cat groupname:cat pid:2766\nline one\nline two\n"
+	pl, err := parseProcessLog("PROCESS_LOG_STDERR", testInput)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cat", pl.ProcessName)
+	assert.Equal(t, "cat", pl.GroupName)
+	assert.Equal(t, 2766, pl.Pid)
+	assert.Equal(t, "stderr", pl.Channel)
+	assert.Equal(t, "line one\nline two\n", pl.Data)
+}
+
+func TestParseRemoteCommunication(t *testing.T) {
+	rc, err := parseRemoteCommunication("type:deploy\nversion=1.2")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "deploy", rc.Type)
+	assert.Equal(t, "version=1.2", rc.Data)
+}
+
+func TestParseSupervisorStateChange(t *testing.T) {
+	assert.Equal(t, "RUNNING", parseSupervisorStateChange("SUPERVISOR_STATE_CHANGE_RUNNING").State)
+	assert.Equal(t, "STOPPING", parseSupervisorStateChange("SUPERVISOR_STATE_CHANGE_STOPPING").State)
+}
+
+func TestParseTick(t *testing.T) {
+	tick, err := parseTick("when:1201063880")
+	assert.NoError(t, err)
+	assert.Equal(t, 1201063880, tick.When)
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5",
+		"ver:2.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6",
+		"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname: len:6",
+		"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:-1",
+		"ver:3.0 server:supervisor serial:x pool:listener poolserial:1 eventname:TICK_5 len:6",
+		"garbage ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6",
+	} {
+		_, err := parseHeader(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParseTokenDataSpaces(t *testing.T) {
+	var ps ProcessState
+	err := parseTokenData("  processname:my  process groupname:cat\tpid:1 \n", &ps)
+	assert.NoError(t, err)
+	assert.Equal(t, "my  process", ps.ProcessName)
+	assert.Equal(t, "cat", ps.GroupName)
+	assert.Equal(t, 1, ps.Pid)
+
+	assert.NoError(t, parseTokenData("", &ps))
+	assert.Error(t, parseTokenData(":x", &ps))
+	assert.Error(t, parseTokenData("no key", &ps))
+
+	//colons and unknown keys are part of a value
+	var pl ProcessLog
+	assert.NoError(t, parseTokenData("processname:web:0 groupname:a b:c pid:7", &pl))
+	assert.Equal(t, "web:0", pl.ProcessName)
+	assert.Equal(t, "a b:c", pl.GroupName)
+	assert.Equal(t, 7, pl.Pid)
+}
+
+// slowReader returns at most one byte per Read.
+type slowReader struct {
+	r io.Reader
+}
+
+func (s slowReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return s.r.Read(p)
+}
+
+func TestReadEvent(t *testing.T) {
+	header := "ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6\n"
+
+	hdr, payload, err := readEvent(bufio.NewReader(slowReader{strings.NewReader(header + "when:5")}), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "TICK_5", hdr.EventName)
+	assert.Equal(t, "when:5", string(payload))
+
+	_, _, err = readEvent(bufio.NewReader(strings.NewReader("")), 6)
+	assert.Equal(t, io.EOF, err)
+
+	for _, test := range []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"truncated header", header[:20], io.ErrUnexpectedEOF},
+		{"truncated payload", header + "when", io.ErrUnexpectedEOF},
+		{"long header", strings.Repeat("x", MaxHeaderLen+1), ErrHeaderTooLong},
+	} {
+		_, _, err = readEvent(bufio.NewReader(strings.NewReader(test.input)), 6)
+		var perr *ProtocolError
+		assert.True(t, errors.As(err, &perr), test.name)
+		assert.True(t, errors.Is(err, test.want), "%s: %v", test.name, err)
+	}
+
+	_, _, err = readEvent(bufio.NewReader(strings.NewReader(header+"when:5")), 5)
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+}
+
+// TestGoldenEvents parses payloads as sent by supervisord for every event
+// type. Run with -update to rewrite the expected results.
+func TestGoldenEvents(t *testing.T) {
+	files, err := filepath.Glob("testdata/events/*.event")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+
+		hdr, payload, err := readEvent(bufio.NewReader(strings.NewReader(string(data))), DefaultMaxPayloadLen)
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+		assert.Equal(t, strings.TrimSuffix(filepath.Base(file), ".event"), hdr.EventName)
+
+		parsed, err := parseEvent(hdr, payload)
+		assert.NoError(t, err, file)
+
+		actual, err := json.MarshalIndent(struct {
+			Header  Header
+			Payload interface{}
+		}{hdr, parsed}, "", "  ")
+		assert.NoError(t, err)
+		actual = append(actual, '\n')
+
+		golden := strings.TrimSuffix(file, ".event") + ".golden"
+		if *update {
+			assert.NoError(t, os.WriteFile(golden, actual, 0644))
+			continue
+		}
+
+		expected, err := os.ReadFile(golden)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual), file)
+	}
+}
+
+func FuzzParseHeader(f *testing.F) {
+	f.Add("ver:3.0 server:supervisor serial:21 pool:listener poolserial:10 eventname:PROCESS_COMMUNICATION_STDOUT len:54")
+	f.Add("ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6\n")
+	f.Add("ver:3.0 len:")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		hdr, err := parseHeader(line)
+		if err != nil {
+			return
+		}
+		if hdr.Version != ProtocolVersion || hdr.EventName == "" || hdr.Len < 0 {
+			t.Errorf("invalid header accepted: %q -> %+v", line, hdr)
+		}
+	})
+}
+
+func FuzzParseTokenData(f *testing.F) {
+	f.Add("processname:cat groupname:cat from_state:STOPPED tries:0 expected:1 pid:2456")
+	f.Add("processname:a b groupname: pid:1")
+	f.Add(":")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		var ps ProcessState
+		parseTokenData(data, &ps)
+
+		tokens, err := splitTokens(data, tokenKeys(&ps))
+		if err != nil {
+			return
+		}
+		for key := range tokens {
+			if key == "" || strings.ContainsAny(key, " \t\n") {
+				t.Errorf("invalid key %q from %q", key, data)
+			}
+		}
+	})
+}
+
+func TestParseProcessStateEvent(t *testing.T) {
+	pse, err := parseProcessStateEvent(PROCESS_STATE_EXITED, "processname:cat groupname:cat from_state:RUNNING expected:0 pid:2766")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cat", pse.ProcessName)
+	assert.Equal(t, state.RUNNING, pse.From)
+	assert.Equal(t, state.EXITED, pse.To)
+	assert.False(t, pse.Expected)
+}
+
+func TestParseProcessCommunication(t *testing.T) {
+	pc, err := parseProcessCommunication(PROCESS_COMMUNICATION_STDOUT, "processname:cat groupname:cat pid:2766\nstatus=ok")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cat", pc.ProcessName)
+	assert.Equal(t, "cat", pc.GroupName)
+	assert.Equal(t, 2766, pc.Pid)
+	assert.Equal(t, "stdout", pc.Channel)
+	assert.Equal(t, "status=ok", pc.Data)
+}
+
+func TestParseProcessGroup(t *testing.T) {
+	pg, err := parseProcessGroup("groupname:cat")
+	assert.NoError(t, err)
+	assert.Equal(t, "cat", pg.GroupName)
+}
+
+func TestParseEventBufferOverflow(t *testing.T) {
+	ebo, err := parseEventBufferOverflow("groupname:listener event_type:ProcessStateRunningEvent")
+	assert.NoError(t, err)
+	assert.Equal(t, "listener", ebo.GroupName)
+	assert.Equal(t, "ProcessStateRunningEvent", ebo.EventType)
+}
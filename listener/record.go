@@ -0,0 +1,95 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Record is an event as stored by a Recorder, one JSON object per line.
+// The payload is base64 encoded, so it is kept byte for byte.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Header  string    `json:"header"`
+	Payload []byte    `json:"payload"`
+}
+
+// Recorder writes events to a JSON lines stream, see Listener.Recorder.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+
+	// Now returns the time stored with each event, time.Now if nil.
+	Now func() time.Time
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes an event.
+func (r *Recorder) Record(h Header, payload []byte) error {
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(Record{Time: now(), Header: h.String(), Payload: payload})
+}
+
+// Replayer feeds recorded events to a Listener.
+type Replayer struct {
+	// Speed scales the delays between events: 1 replays at the original
+	// pace, 10 ten times faster. If zero, events are replayed without
+	// delay.
+	Speed float64
+
+	// Sleep is used to wait between events, time.Sleep if nil.
+	Sleep func(time.Duration)
+}
+
+// Replay passes the events read from r to l as if they came from
+// supervisord, including l's timeout and panic handling, and returns the
+// results. Events are always handled synchronously, regardless of
+// l.QueueSize.
+func (p *Replayer) Replay(r io.Reader, l *Listener) ([]Result, error) {
+	sleep := time.Sleep
+	if p.Sleep != nil {
+		sleep = p.Sleep
+	}
+
+	var results []Result
+	var last time.Time
+
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec Record
+		if err := dec.Decode(&rec); err == io.EOF {
+			return results, nil
+		} else if err != nil {
+			return results, fmt.Errorf("record %d: %v", n, err)
+		}
+
+		hdr, err := parseHeader(rec.Header)
+		if err != nil {
+			return results, fmt.Errorf("record %d: %v", n, err)
+		}
+		if hdr.Len != len(rec.Payload) {
+			return results, fmt.Errorf("record %d: header len %d, but payload has %d bytes", n, hdr.Len, len(rec.Payload))
+		}
+
+		if p.Speed > 0 && !last.IsZero() {
+			if delay := rec.Time.Sub(last); delay > 0 {
+				sleep(time.Duration(float64(delay) / p.Speed))
+			}
+		}
+		last = rec.Time
+
+		results = append(results, l.handle(hdr, rec.Payload))
+	}
+}
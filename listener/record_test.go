@@ -0,0 +1,78 @@
+package listener
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	in := strings.NewReader(
+		"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6\nwhen:5" +
+			"ver:3.0 server:supervisor serial:2 pool:listener poolserial:2 eventname:PROCESS_LOG_STDOUT len:43\nprocessname:a groupname:a pid:1\nhello\nworld")
+
+	var recorded bytes.Buffer
+	times := []time.Time{time.Unix(100, 0).UTC(), time.Unix(110, 0).UTC()}
+	recorder := NewRecorder(&recorded)
+	recorder.Now = func() (now time.Time) {
+		now, times = times[0], times[1:]
+		return
+	}
+
+	l := NewListener(in, io.Discard, HandlerFunc(func(e *Event) Result { return RESULT_OK }))
+	l.Logger = log.New(io.Discard, "", 0)
+	l.Recorder = recorder
+	assert.NoError(t, l.Run())
+
+	lines := strings.Split(strings.TrimSpace(recorded.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, `{"time":"1970-01-01T00:01:40Z","header":"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:6","payload":"d2hlbjo1"}`, lines[0])
+	}
+
+	var events []*Event
+	replay := NewListener(nil, nil, HandlerFunc(func(e *Event) Result {
+		events = append(events, e)
+		if _, ok := e.Payload.(ProcessLog); ok {
+			return RESULT_FAIL
+		}
+		return RESULT_OK
+	}))
+
+	var delays []time.Duration
+	p := &Replayer{Speed: 4, Sleep: func(d time.Duration) { delays = append(delays, d) }}
+	results, err := p.Replay(&recorded, replay)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Result{RESULT_OK, RESULT_FAIL}, results)
+	assert.Equal(t, []time.Duration{2500 * time.Millisecond}, delays)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, Tick{When: 5}, events[0].Payload)
+		assert.Equal(t, 2, events[1].Header.Serial)
+		assert.Equal(t, "hello\nworld", events[1].Payload.(ProcessLog).Data)
+	}
+
+	_, err = p.Replay(strings.NewReader(`{"header":"garbage"}`), replay)
+	assert.Error(t, err)
+	_, err = p.Replay(strings.NewReader(`{"header":"ver:3.0 server:supervisor serial:1 pool:listener poolserial:1 eventname:TICK_5 len:7","payload":"d2hlbjo1"}`), replay)
+	assert.Error(t, err)
+}
+
+func TestRecordBinaryPayload(t *testing.T) {
+	payload := []byte("processname:a groupname:a pid:1\n\xff\xfe\x00")
+	var recorded bytes.Buffer
+	assert.NoError(t, NewRecorder(&recorded).Record(Header{Version: ProtocolVersion, EventName: "PROCESS_LOG_STDOUT", Len: len(payload)}, payload))
+
+	var data string
+	replay := NewListener(nil, nil, HandlerFunc(func(e *Event) Result {
+		data = e.Payload.(ProcessLog).Data
+		return RESULT_OK
+	}))
+	results, err := new(Replayer).Replay(&recorded, replay)
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{RESULT_OK}, results)
+	assert.Equal(t, "\xff\xfe\x00", data)
+}
@@ -0,0 +1,174 @@
+package listener
+
+import (
+	"context"
+	supervisor "github.com/Ligustah/go-supervisor"
+	"sort"
+)
+
+// Event is a notification received from supervisord.
+type Event struct {
+	Header Header
+
+	// Raw is the payload as sent by supervisord.
+	Raw []byte
+
+	// Payload is the parsed payload: a ProcessStateEvent, ProcessLog,
+	// ProcessCommunication, ProcessGroup, RemoteCommunication,
+	// SupervisorStateChange, Tick or EventBufferOverflow value, or nil for
+	// event types without a known structure.
+	Payload interface{}
+
+	// Supervisor is the client attached to the Listener, or nil.
+	Supervisor supervisor.Supervisor
+
+	ctx context.Context
+}
+
+// Context returns the context of the event, which is cancelled when the
+// handler's time is up.
+func (e *Event) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// Handler processes events. The returned Result is sent back to
+// supervisord; RESULT_FAIL makes it deliver the event again later.
+type Handler interface {
+	HandleEvent(*Event) Result
+}
+
+type HandlerFunc func(*Event) Result
+
+func (f HandlerFunc) HandleEvent(e *Event) Result {
+	return f(e)
+}
+
+// The typed handler functions can be registered with a Router as well.
+// Events whose payload does not match are acknowledged without calling them.
+
+func (p ProcessStateHandlerFunc) HandleEvent(e *Event) Result {
+	if pse, ok := e.Payload.(ProcessStateEvent); ok {
+		return p(e.Header, pse.ProcessState)
+	}
+	return RESULT_OK
+}
+
+func (r RemoteCommunicationHandlerFunc) HandleEvent(e *Event) Result {
+	if rc, ok := e.Payload.(RemoteCommunication); ok {
+		return r(e.Header, rc)
+	}
+	return RESULT_OK
+}
+
+func (p ProcessLogHandlerFunc) HandleEvent(e *Event) Result {
+	if pl, ok := e.Payload.(ProcessLog); ok {
+		return p(e.Header, pl)
+	}
+	return RESULT_OK
+}
+
+func (s SupervisorStateChangeHandlerFunc) HandleEvent(e *Event) Result {
+	if sc, ok := e.Payload.(SupervisorStateChange); ok {
+		return s(e.Header, sc)
+	}
+	return RESULT_OK
+}
+
+func (t TickHandlerFunc) HandleEvent(e *Event) Result {
+	if tick, ok := e.Payload.(Tick); ok {
+		return t(e.Header, tick)
+	}
+	return RESULT_OK
+}
+
+func (p ProcessCommunicationHandlerFunc) HandleEvent(e *Event) Result {
+	if pc, ok := e.Payload.(ProcessCommunication); ok {
+		return p(e.Header, pc)
+	}
+	return RESULT_OK
+}
+
+func (p ProcessGroupHandlerFunc) HandleEvent(e *Event) Result {
+	if pg, ok := e.Payload.(ProcessGroup); ok {
+		return p(e.Header, pg)
+	}
+	return RESULT_OK
+}
+
+func (f EventBufferOverflowHandlerFunc) HandleEvent(e *Event) Result {
+	if ebo, ok := e.Payload.(EventBufferOverflow); ok {
+		return f(e.Header, ebo)
+	}
+	return RESULT_OK
+}
+
+type route struct {
+	eventType EventType
+	handler   Handler
+}
+
+// Router dispatches events to the handler registered for the most specific
+// matching type in the event type hierarchy: a handler for PROCESS_STATE
+// receives PROCESS_STATE_EXITED events unless there is one for
+// PROCESS_STATE_EXITED itself, and a handler for EVENT receives everything
+// else. Events without a matching handler are acknowledged.
+type Router struct {
+	routes []route
+}
+
+func NewRouter() *Router {
+	return new(Router)
+}
+
+// Handle registers h for t, replacing an earlier registration.
+func (r *Router) Handle(t EventType, h Handler) {
+	for i := range r.routes {
+		if r.routes[i].eventType == t {
+			r.routes[i].handler = h
+			return
+		}
+	}
+
+	r.routes = append(r.routes, route{t, h})
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].eventType.depth() > r.routes[j].eventType.depth()
+	})
+}
+
+func (r *Router) HandleFunc(t EventType, f func(*Event) Result) {
+	r.Handle(t, HandlerFunc(f))
+}
+
+// Handler returns the handler events of type t are dispatched to, or nil.
+func (r *Router) Handler(t EventType) Handler {
+	for _, route := range r.routes {
+		if t.Is(route.eventType) {
+			return route.handler
+		}
+	}
+	return nil
+}
+
+func (r *Router) HandleEvent(e *Event) Result {
+	if h := r.Handler(e.Header.EventType()); h != nil {
+		return h.HandleEvent(e)
+	}
+	return RESULT_OK
+}
+
+// All returns a Handler passing every event to each of handlers in order.
+// The event fails if any of them fails.
+func All(handlers ...Handler) Handler {
+	return HandlerFunc(func(e *Event) Result {
+		result := RESULT_OK
+		for _, h := range handlers {
+			if h.HandleEvent(e) != RESULT_OK {
+				result = RESULT_FAIL
+			}
+		}
+		return result
+	})
+}
@@ -0,0 +1,60 @@
+package listener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRouterMatching(t *testing.T) {
+	var called []string
+	record := func(name string, result Result) Handler {
+		return HandlerFunc(func(e *Event) Result {
+			called = append(called, name+":"+e.Header.EventName)
+			return result
+		})
+	}
+
+	r := NewRouter()
+	r.Handle(EVENT, record("all", RESULT_OK))
+	r.Handle("PROCESS_STATE", record("state", RESULT_OK))
+	r.Handle("PROCESS_STATE_EXITED", record("exited", RESULT_FAIL))
+	r.Handle("TICK_5", record("tick5", RESULT_OK))
+
+	assert.Equal(t, RESULT_FAIL, r.HandleEvent(&Event{Header: Header{EventName: "PROCESS_STATE_EXITED"}}))
+	assert.Equal(t, RESULT_OK, r.HandleEvent(&Event{Header: Header{EventName: "PROCESS_STATE_RUNNING"}}))
+	assert.Equal(t, RESULT_OK, r.HandleEvent(&Event{Header: Header{EventName: "TICK_5"}}))
+	assert.Equal(t, RESULT_OK, r.HandleEvent(&Event{Header: Header{EventName: "TICK_60"}}))
+
+	assert.Equal(t, []string{
+		"exited:PROCESS_STATE_EXITED",
+		"state:PROCESS_STATE_RUNNING",
+		"tick5:TICK_5",
+		"all:TICK_60",
+	}, called)
+}
+
+func TestRouterTypedHandlers(t *testing.T) {
+	var state ProcessState
+	r := NewRouter()
+	r.Handle(EVENT, ProcessStateHandlerFunc(func(h Header, ps ProcessState) Result {
+		state = ps
+		return RESULT_FAIL
+	}))
+
+	l := &Listener{Handler: r}
+	assert.Equal(t, RESULT_FAIL, l.handle(Header{EventName: "PROCESS_STATE_EXITED"}, []byte("processname:cat groupname:cat from_state:RUNNING expected:0 pid:2766")))
+	assert.Equal(t, "cat", state.ProcessName)
+
+	//payload of a different type is acknowledged without calling the handler
+	assert.Equal(t, RESULT_OK, l.handle(Header{EventName: "TICK_5"}, []byte("when:5")))
+}
+
+func TestAll(t *testing.T) {
+	count := 0
+	ok := HandlerFunc(func(e *Event) Result { count++; return RESULT_OK })
+	fail := HandlerFunc(func(e *Event) Result { count++; return RESULT_FAIL })
+
+	assert.Equal(t, RESULT_OK, All(ok, ok).HandleEvent(&Event{}))
+	assert.Equal(t, RESULT_FAIL, All(fail, ok).HandleEvent(&Event{}))
+	assert.Equal(t, 4, count)
+}
@@ -0,0 +1,176 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job is a task run by a Scheduler. The context is cancelled when the
+// job's timeout expires or the Scheduler is closed.
+type Job func(ctx context.Context) error
+
+// JobStatus describes the runs of a job.
+type JobStatus struct {
+	Name string
+
+	// Next is the time the job is due next; zero until the first tick.
+	Next time.Time
+
+	// LastRun is the time the last run was started, LastDuration how long
+	// it took and LastError the error it returned.
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    error
+
+	Running bool
+
+	Runs     int
+	Failures int
+
+	// Skipped counts runs that were due while the previous run was still
+	// going.
+	Skipped int
+}
+
+type scheduledJob struct {
+	schedule Schedule
+	timeout  time.Duration
+	job      Job
+	status   JobStatus
+}
+
+// Scheduler runs jobs driven by TICK events, so periodic work can be done
+// by an event listener without a separate cron. Register it for TICK_5,
+// TICK_60 or TICK_3600; jobs can't run more often than the ticks arrive.
+//
+// Due jobs are started in their own goroutine, so the event is
+// acknowledged right away. A job that is still running when it is due
+// again is skipped.
+type Scheduler struct {
+	mu     sync.Mutex
+	jobs   []*scheduledJob
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewScheduler() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{ctx: ctx, cancel: cancel}
+}
+
+// Add registers a job. If timeout is positive, the context passed to the
+// job is cancelled after that time.
+func (s *Scheduler) Add(name string, schedule Schedule, timeout time.Duration, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.status.Name == name {
+			return fmt.Errorf("job %s already exists", name)
+		}
+	}
+
+	s.jobs = append(s.jobs, &scheduledJob{
+		schedule: schedule,
+		timeout:  timeout,
+		job:      job,
+		status:   JobStatus{Name: name},
+	})
+	return nil
+}
+
+// HandleEvent starts the jobs due at the time of a TICK event. Other
+// events are ignored.
+func (s *Scheduler) HandleEvent(e *Event) Result {
+	if tick, ok := e.Payload.(Tick); ok {
+		s.Tick(time.Unix(int64(tick.When), 0))
+	}
+	return RESULT_OK
+}
+
+// Tick starts the jobs due at now. The first call only computes when each
+// job is due.
+func (s *Scheduler) Tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	for _, j := range s.jobs {
+		if j.status.Next.IsZero() {
+			j.status.Next = j.schedule.Next(now)
+			continue
+		}
+		if now.Before(j.status.Next) {
+			continue
+		}
+
+		j.status.Next = j.schedule.Next(now)
+		if j.status.Running {
+			j.status.Skipped++
+			continue
+		}
+
+		j.status.Running = true
+		j.status.LastRun = now
+		s.wg.Add(1)
+		go s.run(j)
+	}
+}
+
+func (s *Scheduler) run(j *scheduledJob) {
+	defer s.wg.Done()
+
+	ctx, cancel := s.ctx, context.CancelFunc(func() {})
+	if j.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	err := j.job(ctx)
+	if err == nil {
+		//a job ignoring its context still counts as failed
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j.status.Running = false
+	j.status.LastDuration = time.Since(start)
+	j.status.LastError = err
+	j.status.Runs++
+	if err != nil {
+		j.status.Failures++
+	}
+}
+
+// Status returns the status of every job in the order they were added.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make([]JobStatus, len(s.jobs))
+	for i, j := range s.jobs {
+		status[i] = j.status
+	}
+	return status
+}
+
+// Wait blocks until no job is running.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Close cancels running jobs, waits for them to return and stops starting
+// new ones.
+func (s *Scheduler) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
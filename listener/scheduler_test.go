@@ -0,0 +1,94 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 23, 58, 30, 0, time.UTC)
+
+	for expr, expected := range map[string]time.Time{
+		"* * * * *":      time.Date(2024, time.January, 31, 23, 59, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"30 4 * * *":     time.Date(2024, time.February, 1, 4, 30, 0, 0, time.UTC),
+		"0 0 29 2 *":     time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		"0 12 * * 7":     time.Date(2024, time.February, 4, 12, 0, 0, 0, time.UTC),
+		"0 12 * * 1-5/2": time.Date(2024, time.February, 2, 12, 0, 0, 0, time.UTC),
+		"0 0 15 * 1":     time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC),
+		"0 0 */2 * 1":    time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC),
+		"5,10 8 1 3 *":   time.Date(2024, time.March, 1, 8, 5, 0, 0, time.UTC),
+		"0 0 31 2 *":     {},
+	} {
+		schedule, err := Cron(expr)
+		if assert.NoError(t, err, expr) {
+			assert.Equal(t, expected, schedule.Next(start), expr)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := Cron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler()
+	defer s.Close()
+
+	runs := make(chan time.Time, 10)
+	release := make(chan struct{})
+	assert.NoError(t, s.Add("slow", Every(time.Minute), 0, func(ctx context.Context) error {
+		runs <- time.Now()
+		<-release
+		return nil
+	}))
+	assert.NoError(t, s.Add("failing", Every(time.Minute), 0, func(ctx context.Context) error {
+		return errors.New("failed")
+	}))
+	assert.NoError(t, s.Add("timeout", Every(time.Minute), 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	assert.Error(t, s.Add("slow", Every(time.Hour), 0, nil))
+
+	tick := func(when int) {
+		result := s.HandleEvent(&Event{Header: Header{EventName: "TICK_60"}, Payload: Tick{When: when}})
+		assert.Equal(t, RESULT_OK, result)
+	}
+
+	tick(1000)
+	tick(1030)
+	select {
+	case <-runs:
+		t.Fatal("job ran before it was due")
+	default:
+	}
+
+	tick(1060)
+	<-runs
+
+	//the slow job is still running
+	tick(1120)
+	close(release)
+	s.Wait()
+
+	status := s.Status()
+	assert.Equal(t, "slow", status[0].Name)
+	assert.Equal(t, 1, status[0].Runs)
+	assert.Equal(t, 1, status[0].Skipped)
+	assert.Equal(t, time.Unix(1060, 0), status[0].LastRun)
+	assert.Equal(t, time.Unix(1180, 0), status[0].Next)
+	assert.NoError(t, status[0].LastError)
+
+	//the failing job may still have been running at the second tick
+	assert.Equal(t, 2, status[1].Runs+status[1].Skipped)
+	assert.Equal(t, status[1].Runs, status[1].Failures)
+	assert.EqualError(t, status[1].LastError, "failed")
+
+	assert.Equal(t, context.DeadlineExceeded, status[2].LastError)
+	assert.False(t, status[2].Running)
+}
@@ -0,0 +1,203 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Gap describes events of a pool that were never received, as told by
+// the pool serials: From and To are the first and last one missing.
+type Gap struct {
+	Pool     string
+	From, To int
+}
+
+// DefaultSerialWindow is the number of events per pool a SerialTracker
+// remembers if its Window is not set.
+const DefaultSerialWindow = 256
+
+type poolSerials struct {
+	// Last is the highest pool serial received.
+	Last int `json:"last"`
+
+	// Done identifies the most recent events processed, oldest first.
+	Done []string `json:"done"`
+
+	// Boot identifies the supervisord the events came from, zero if
+	// unknown.
+	Boot int `json:"boot,omitempty"`
+}
+
+// SerialTracker recognises events supervisord delivers again although they
+// have been processed, which happens if the listener dies before its
+// result reaches supervisord, and detects events that were dropped, see
+// Listener.Serials.
+//
+// Pool serials count the events sent to a pool, so gaps are only
+// meaningful for pools with a single listener process (numprocs=1). A pool
+// serial lower than the last one, or events from another boot of
+// supervisord, mean supervisord was restarted and counts from zero again.
+type SerialTracker struct {
+	// Path is the file the processed events are saved to, so they are
+	// remembered across listener restarts. If empty, they are kept in
+	// memory only.
+	Path string
+
+	// Window is the number of processed events remembered per pool,
+	// DefaultSerialWindow if zero.
+	Window int
+
+	// OnGap is called for events that were never received.
+	OnGap func(Gap)
+
+	// OnReset is called when supervisord was restarted, with the last
+	// pool serial received before and the one received now.
+	OnReset func(pool string, last, serial int)
+
+	// Boot identifies the running supervisord, os.Getppid if nil. For the
+	// default to tell boots apart, supervisord must start the listener
+	// directly rather than through a shell that stays its parent.
+	Boot func() int
+
+	mu    sync.Mutex
+	pools map[string]*poolSerials
+}
+
+// NewSerialTracker returns a SerialTracker saving to path, loading the
+// events processed earlier if the file exists.
+func NewSerialTracker(path string) (*SerialTracker, error) {
+	t := &SerialTracker{Path: path, pools: make(map[string]*poolSerials)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &t.pools); err != nil {
+		return nil, fmt.Errorf("serials %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// eventKey identifies an event. Serials start from zero after a restart of
+// supervisord, so the payload is part of the key.
+func eventKey(h Header, payload []byte) string {
+	hash := fnv.New64a()
+	hash.Write(payload)
+	return fmt.Sprintf("%d:%d:%s:%x", h.Serial, h.PoolSerial, h.EventName, hash.Sum64())
+}
+
+func (t *SerialTracker) pool(name string) *poolSerials {
+	if t.pools == nil {
+		t.pools = make(map[string]*poolSerials)
+	}
+	p := t.pools[name]
+	if p == nil {
+		p = &poolSerials{Last: -1}
+		t.pools[name] = p
+	}
+	return p
+}
+
+// Check reports whether the event has been processed before. For new
+// events, it calls OnGap or OnReset if the pool serial is not the one
+// expected. A restarted supervisord sends its first events with the same
+// serials and payloads as before, so a reset is detected before looking
+// for a processed event. The pool serial can't tell a restart after the
+// first event from a redelivery of it, which is why the boot is compared
+// too.
+func (t *SerialTracker) Check(h Header, payload []byte) (duplicate bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	boot := os.Getppid
+	if t.Boot != nil {
+		boot = t.Boot
+	}
+
+	p := t.pool(h.Pool)
+	id := boot()
+	restarted := p.Boot != 0 && p.Boot != id
+	p.Boot = id
+	if restarted || p.Last >= 0 && h.PoolSerial < p.Last {
+		if t.OnReset != nil {
+			t.OnReset(h.Pool, p.Last, h.PoolSerial)
+		}
+		p.Done = nil
+		p.Last = h.PoolSerial
+		return false
+	}
+
+	key := eventKey(h, payload)
+	for _, done := range p.Done {
+		if done == key {
+			return true
+		}
+	}
+
+	//the first event, an event failed before or the next one are expected
+	if p.Last >= 0 && h.PoolSerial > p.Last+1 && t.OnGap != nil {
+		t.OnGap(Gap{Pool: h.Pool, From: p.Last + 1, To: h.PoolSerial - 1})
+	}
+	p.Last = h.PoolSerial
+	return false
+}
+
+// Done records that the event has been processed and saves the file. The
+// file is written and synced for every event, which limits the rate of
+// events a listener with a Path can process to that of the disk.
+func (t *SerialTracker) Done(h Header, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window := t.Window
+	if window <= 0 {
+		window = DefaultSerialWindow
+	}
+
+	p := t.pool(h.Pool)
+	p.Done = append(p.Done, eventKey(h, payload))
+	if len(p.Done) > window {
+		p.Done = append([]string(nil), p.Done[len(p.Done)-window:]...)
+	}
+	if h.PoolSerial > p.Last {
+		p.Last = h.PoolSerial
+	}
+
+	if t.Path == "" {
+		return nil
+	}
+	return t.save()
+}
+
+// save writes the file atomically, so a crash leaves either the old or the
+// new version.
+func (t *SerialTracker) save() error {
+	data, err := json.Marshal(t.pools)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(t.Path), filepath.Base(t.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), t.Path)
+}
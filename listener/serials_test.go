@@ -0,0 +1,133 @@
+package listener
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSerialTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serials.json")
+
+	var gaps []Gap
+	var resets []string
+	track := func() *SerialTracker {
+		tracker, err := NewSerialTracker(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.OnGap = func(g Gap) { gaps = append(gaps, g) }
+		tracker.OnReset = func(pool string, last, serial int) {
+			resets = append(resets, fmt.Sprintf("%s %d->%d", pool, last, serial))
+		}
+		return tracker
+	}
+	tick := func(serial, poolSerial int) Header {
+		return Header{Pool: "listener", Serial: serial, PoolSerial: poolSerial, EventName: "TICK_5"}
+	}
+
+	tracker := track()
+	assert.False(t, tracker.Check(tick(10, 0), []byte("when:5")))
+	assert.NoError(t, tracker.Done(tick(10, 0), []byte("when:5")))
+	assert.True(t, tracker.Check(tick(10, 0), []byte("when:5")))
+
+	//failed events are not remembered
+	assert.False(t, tracker.Check(tick(11, 1), []byte("when:10")))
+	assert.False(t, tracker.Check(tick(11, 1), []byte("when:10")))
+	assert.NoError(t, tracker.Done(tick(11, 1), []byte("when:10")))
+	assert.Empty(t, gaps)
+
+	assert.False(t, tracker.Check(tick(14, 4), []byte("when:25")))
+	assert.NoError(t, tracker.Done(tick(14, 4), []byte("when:25")))
+	assert.Equal(t, []Gap{{Pool: "listener", From: 2, To: 3}}, gaps)
+
+	//a restarted listener remembers the events
+	tracker = track()
+	assert.True(t, tracker.Check(tick(14, 4), []byte("when:25")))
+
+	//serials restart with supervisord
+	assert.False(t, tracker.Check(tick(0, 0), []byte("when:30")))
+	assert.Equal(t, []string{"listener 4->0"}, resets)
+	assert.False(t, tracker.Check(tick(10, 0), []byte("when:5")))
+
+	//events beyond the window are forgotten
+	tracker.Window = 1
+	assert.NoError(t, tracker.Done(tick(0, 0), []byte("when:30")))
+	assert.NoError(t, tracker.Done(tick(1, 1), []byte("when:35")))
+	assert.True(t, tracker.Check(tick(1, 1), []byte("when:35")))
+	assert.False(t, tracker.Check(tick(0, 0), []byte("when:30")))
+	assert.Equal(t, []string{"listener 4->0", "listener 1->0"}, resets)
+	assert.Len(t, gaps, 1)
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err := NewSerialTracker(path)
+	assert.Error(t, err)
+}
+
+func TestSerialTrackerRestart(t *testing.T) {
+	tracker, err := NewSerialTracker(filepath.Join(t.TempDir(), "serials.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resets []string
+	tracker.OnReset = func(pool string, last, serial int) {
+		resets = append(resets, fmt.Sprintf("%s %d->%d", pool, last, serial))
+	}
+	pid := 100
+	tracker.Boot = func() int { return pid }
+
+	//the events every boot of supervisord starts with
+	boot := []struct {
+		h       Header
+		payload []byte
+	}{
+		{Header{Pool: "listener", Serial: 0, PoolSerial: 0, EventName: "SUPERVISOR_STATE_CHANGE_RUNNING"}, []byte{}},
+		{Header{Pool: "listener", Serial: 1, PoolSerial: 1, EventName: "PROCESS_STATE_STARTING"}, []byte("processname:web groupname:web from_state:STOPPED tries:0")},
+	}
+	//a restart right after the first event only shows in the boot
+	assert.False(t, tracker.Check(boot[0].h, boot[0].payload))
+	assert.NoError(t, tracker.Done(boot[0].h, boot[0].payload))
+	assert.True(t, tracker.Check(boot[0].h, boot[0].payload))
+	pid = 200
+	assert.False(t, tracker.Check(boot[0].h, boot[0].payload))
+	assert.Equal(t, []string{"listener 0->0"}, resets)
+	assert.NoError(t, tracker.Done(boot[0].h, boot[0].payload))
+
+	assert.False(t, tracker.Check(boot[1].h, boot[1].payload))
+	assert.NoError(t, tracker.Done(boot[1].h, boot[1].payload))
+	for serial := 2; serial <= 3; serial++ {
+		h := Header{Pool: "listener", Serial: serial, PoolSerial: serial, EventName: "TICK_5"}
+		assert.False(t, tracker.Check(h, []byte("when:5")))
+		assert.NoError(t, tracker.Done(h, []byte("when:5")))
+	}
+
+	//after a restart, the same events are new ones; a reload keeps the
+	//process, so only the pool serial tells
+	for _, e := range boot {
+		assert.False(t, tracker.Check(e.h, e.payload), e.h.EventName)
+		assert.NoError(t, tracker.Done(e.h, e.payload))
+	}
+	assert.Equal(t, []string{"listener 0->0", "listener 3->0"}, resets)
+	assert.True(t, tracker.Check(boot[1].h, boot[1].payload))
+}
+
+func TestListenerSerials(t *testing.T) {
+	event := "ver:3.0 server:supervisor serial:7 pool:listener poolserial:3 eventname:TICK_5 len:6\nwhen:5"
+	var out strings.Builder
+	calls := 0
+	l := NewListener(strings.NewReader(event+event), &out, HandlerFunc(func(e *Event) Result {
+		calls++
+		return RESULT_OK
+	}))
+	l.Logger = log.New(io.Discard, "", 0)
+	l.Serials = &SerialTracker{}
+
+	assert.NoError(t, l.Run())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "READY\nRESULT 2\nOKREADY\nRESULT 2\nOKREADY\n", out.String())
+}
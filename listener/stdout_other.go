@@ -0,0 +1,24 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package listener
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoDup = errors.New("duplicating file descriptors is not supported")
+
+func dup(fd int) (int, error) {
+	return -1, errNoDup
+}
+
+func dup2(oldfd, newfd int) error {
+	return errNoDup
+}
+
+// isolateStdout returns os.Stdout unchanged, since its file descriptor
+// can't be redirected on this platform.
+func isolateStdout() (out *os.File, restore func(), err error) {
+	return os.Stdout, func() {}, nil
+}
@@ -0,0 +1,41 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package listener
+
+import (
+	"os"
+	"syscall"
+)
+
+// dup returns a copy of file descriptor fd that is not inherited by child
+// processes.
+func dup(fd int) (int, error) {
+	copied, err := syscall.Dup(fd)
+	if err != nil {
+		return -1, err
+	}
+	syscall.CloseOnExec(copied)
+	return copied, nil
+}
+
+// isolateStdout moves the standard output of the process to a private file
+// for the protocol and points file descriptor 1 at stderr, so anything
+// else written to stdout, by this process or its children, can't end up in
+// the protocol. restore points file descriptor 1 back at the protocol.
+func isolateStdout() (out *os.File, restore func(), err error) {
+	fd, err := dup(syscall.Stdout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = dup2(syscall.Stderr, syscall.Stdout); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+
+	out = os.NewFile(uintptr(fd), "/dev/stdout")
+	restore = func() {
+		dup2(fd, syscall.Stdout)
+		out.Close()
+	}
+	return out, restore, nil
+}
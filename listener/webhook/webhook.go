@@ -0,0 +1,387 @@
+// Package webhook implements an event listener posting events to HTTP
+// endpoints.
+//
+// Delivery with retries may take a while, so the listener should run in
+// acknowledge-then-process mode (see listener.Listener.QueueSize) to keep
+// supervisord from blocking.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ligustah/go-supervisor/listener"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrCircuitOpen = errors.New("circuit open")
+	ErrDuplicate   = errors.New("duplicate event")
+)
+
+// Clock abstracts time for testing.
+type Clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Destination is an endpoint events are posted to.
+type Destination struct {
+	// Name identifies the destination in logs.
+	Name string
+	URL  string
+
+	// Events are the event types sent; all events if empty.
+	Events []listener.EventType
+
+	// Template renders the request body from a Data value. It must produce
+	// JSON; the json function encodes a value. If empty, Data itself is
+	// sent as JSON.
+	Template string
+
+	// Headers are added to every request. Content-Type defaults to
+	// application/json.
+	Headers map[string]string
+
+	// Timeout limits each request, including reading the response, 10
+	// seconds if zero. A request timing out counts as a failed delivery.
+	Timeout time.Duration
+
+	// Retries is the number of additional attempts after a failed
+	// delivery. RetryDelay is the wait before the first retry, doubled for
+	// each further one; 1 second if zero.
+	Retries    int
+	RetryDelay time.Duration
+
+	// RateLimit is the maximum number of deliveries per RatePeriod;
+	// events beyond it are dropped. Zero disables the limit.
+	RateLimit  int
+	RatePeriod time.Duration
+
+	// Dedup drops events equal to one sent within this period. Events are
+	// equal if they have the same type and concern the same process, or
+	// have the same payload if they don't concern a process.
+	Dedup time.Duration
+
+	// BreakerThreshold is the number of failed deliveries in a row after
+	// which no deliveries are attempted for BreakerCooldown. Zero disables
+	// the circuit breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	template *template.Template
+
+	mu        sync.Mutex
+	sent      []time.Time
+	seen      map[string]time.Time
+	failures  int
+	openUntil time.Time
+}
+
+// Data is passed to payload templates.
+type Data struct {
+	Event   string          `json:"event"`
+	Process string          `json:"process,omitempty"`
+	Group   string          `json:"group,omitempty"`
+	Time    time.Time       `json:"time"`
+	Header  listener.Header `json:"header"`
+	Payload interface{}     `json:"payload"`
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Notifier is a listener.Handler posting events to destinations.
+type Notifier struct {
+	Destinations []*Destination
+
+	// Client is used for requests, http.DefaultClient if nil.
+	Client *http.Client
+
+	// Clock defaults to the system clock.
+	Clock Clock
+
+	// Logger receives delivery errors. If nil, they are written to stderr.
+	Logger *log.Logger
+}
+
+// NewNotifier returns a Notifier for destinations, checking their
+// settings and parsing their templates.
+func NewNotifier(destinations ...*Destination) (*Notifier, error) {
+	for _, d := range destinations {
+		if d.URL == "" {
+			return nil, fmt.Errorf("webhook %s: no URL", d.Name)
+		}
+		if d.RateLimit > 0 && d.RatePeriod <= 0 {
+			return nil, fmt.Errorf("webhook %s: rate limit without period", d.Name)
+		}
+		if _, err := d.parse(); err != nil {
+			return nil, fmt.Errorf("webhook %s: %v", d.Name, err)
+		}
+	}
+	return &Notifier{Destinations: destinations}, nil
+}
+
+func (n *Notifier) logf(format string, v ...interface{}) {
+	if n.Logger != nil {
+		n.Logger.Printf(format, v...)
+		return
+	}
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, v...)
+}
+
+func (n *Notifier) clock() Clock {
+	if n.Clock != nil {
+		return n.Clock
+	}
+	return realClock{}
+}
+
+// newData collects the template data of an event.
+func newData(e *listener.Event, now time.Time) *Data {
+	d := &Data{Event: e.Header.EventName, Time: now, Header: e.Header, Payload: e.Payload}
+
+	//all payloads concerning a process have ProcessName and GroupName fields
+	v := reflect.ValueOf(e.Payload)
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("ProcessName"); f.IsValid() && f.Kind() == reflect.String {
+			d.Process = f.String()
+		}
+		if f := v.FieldByName("GroupName"); f.IsValid() && f.Kind() == reflect.String {
+			d.Group = f.String()
+		}
+	}
+	return d
+}
+
+func (d *Data) key() string {
+	if d.Process != "" {
+		return d.Event + " " + d.Group + ":" + d.Process
+	}
+	data, _ := json.Marshal(d.Payload)
+	return d.Event + " " + string(data)
+}
+
+// HandleEvent posts the event to every destination subscribed to it.
+// Delivery problems are logged; the event is always acknowledged, since
+// supervisord redelivering it would repeat it for every destination.
+func (n *Notifier) HandleEvent(e *listener.Event) listener.Result {
+	data := newData(e, n.clock().Now())
+	for _, d := range n.Destinations {
+		if !d.subscribed(e.Header.EventType()) {
+			continue
+		}
+		if err := n.Deliver(d, data); err != nil {
+			n.logf("webhook %s: %s: %v", d.Name, data.Event, err)
+		}
+	}
+	return listener.RESULT_OK
+}
+
+func (d *Destination) subscribed(t listener.EventType) bool {
+	if len(d.Events) == 0 {
+		return true
+	}
+	for _, et := range d.Events {
+		if t.Is(et) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit applies deduplication, the circuit breaker and the rate limit.
+func (d *Destination) admit(key string, now time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Dedup > 0 {
+		if d.seen == nil {
+			d.seen = make(map[string]time.Time)
+		}
+		for k, t := range d.seen {
+			if now.Sub(t) >= d.Dedup {
+				delete(d.seen, k)
+			}
+		}
+		if _, ok := d.seen[key]; ok {
+			return ErrDuplicate
+		}
+	}
+
+	if now.Before(d.openUntil) {
+		return ErrCircuitOpen
+	}
+
+	if d.RateLimit > 0 {
+		i := 0
+		for i < len(d.sent) && now.Sub(d.sent[i]) >= d.RatePeriod {
+			i++
+		}
+		d.sent = d.sent[i:]
+		if len(d.sent) >= d.RateLimit {
+			return ErrRateLimited
+		}
+		d.sent = append(d.sent, now)
+	}
+
+	//duplicates are dropped while the event is being delivered, too
+	if d.Dedup > 0 {
+		d.seen[key] = now
+	}
+	return nil
+}
+
+// forget allows duplicates of an event that was not delivered.
+func (d *Destination) forget(key string) {
+	if d.Dedup > 0 {
+		delete(d.seen, key)
+	}
+}
+
+// record updates the circuit breaker with the outcome of a delivery.
+// Only events delivered successfully keep counting for deduplication.
+func (d *Destination) record(key string, err error, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil {
+		d.failures = 0
+		if d.Dedup > 0 {
+			d.seen[key] = now
+		}
+		return
+	}
+
+	d.forget(key)
+	d.failures++
+	if d.BreakerThreshold > 0 && d.failures >= d.BreakerThreshold {
+		d.openUntil = now.Add(d.BreakerCooldown)
+		//a single failure after the cooldown opens the circuit again
+		d.failures = d.BreakerThreshold - 1
+	}
+}
+
+// parse returns the parsed Template, parsing it on first use if the
+// Destination was not checked by NewNotifier.
+func (d *Destination) parse() (*template.Template, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.template == nil && d.Template != "" {
+		t, err := template.New(d.Name).Funcs(funcs).Parse(d.Template)
+		if err != nil {
+			return nil, err
+		}
+		d.template = t
+	}
+	return d.template, nil
+}
+
+func (d *Destination) body(data *Data) ([]byte, error) {
+	t, err := d.parse()
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return json.Marshal(data)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template did not produce valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// Deliver posts data to d, retrying failed requests. It returns
+// ErrDuplicate, ErrCircuitOpen or ErrRateLimited if the event was dropped.
+func (n *Notifier) Deliver(d *Destination, data *Data) error {
+	clock := n.clock()
+	key := data.key()
+	if err := d.admit(key, clock.Now()); err != nil {
+		return err
+	}
+
+	body, err := d.body(data)
+	if err != nil {
+		d.mu.Lock()
+		d.forget(key)
+		d.mu.Unlock()
+		return err
+	}
+
+	delay := d.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(d, body)
+		if err == nil || attempt >= d.Retries {
+			break
+		}
+		clock.Sleep(delay)
+		delay *= 2
+	}
+
+	d.record(key, err, clock.Now())
+	return err
+}
+
+func (n *Notifier) post(d *Destination, body []byte) error {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range d.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", d.URL, resp.Status)
+	}
+	return nil
+}
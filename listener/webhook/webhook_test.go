@@ -0,0 +1,221 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ligustah/go-supervisor/listener"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// endpoint records request bodies and answers with the next status.
+type endpoint struct {
+	mu       sync.Mutex
+	bodies   []string
+	statuses []int
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	e.bodies = append(e.bodies, string(body))
+
+	status := http.StatusOK
+	if len(e.statuses) > 0 {
+		status, e.statuses = e.statuses[0], e.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func exited(process string) *listener.Event {
+	return &listener.Event{
+		Header: listener.Header{EventName: "PROCESS_STATE_EXITED", Serial: 7},
+		Payload: listener.ProcessStateEvent{ProcessState: listener.ProcessState{
+			ProcessName: process,
+			GroupName:   "web",
+			FromState:   "RUNNING",
+			Pid:         42,
+		}},
+	}
+}
+
+func newTestNotifier(t *testing.T, d *Destination) (*Notifier, *endpoint, *fakeClock) {
+	ep := &endpoint{}
+	server := httptest.NewServer(ep)
+	t.Cleanup(server.Close)
+
+	d.URL = server.URL
+	n, err := NewNotifier(d)
+	assert.NoError(t, err)
+
+	clock := &fakeClock{now: time.Unix(1000, 0).UTC()}
+	n.Clock = clock
+	n.Logger = log.New(io.Discard, "", 0)
+	return n, ep, clock
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	n, ep, _ := newTestNotifier(t, &Destination{
+		Name:     "oncall",
+		Events:   []listener.EventType{listener.PROCESS_STATE_EXITED, listener.PROCESS_STATE_FATAL},
+		Template: `{"summary": {{ printf "%s:%s %s" .Group .Process .Event | json }}, "pid": {{ .Payload.Pid }}}`,
+	})
+
+	assert.Equal(t, listener.RESULT_OK, n.HandleEvent(exited("web_0")))
+	assert.Equal(t, listener.RESULT_OK, n.HandleEvent(&listener.Event{
+		Header:  listener.Header{EventName: "TICK_60"},
+		Payload: listener.Tick{When: 60},
+	}))
+
+	assert.Equal(t, []string{`{"summary": "web:web_0 PROCESS_STATE_EXITED", "pid": 42}`}, ep.bodies)
+
+	_, err := NewNotifier(&Destination{Name: "broken", URL: "http://localhost", Template: "{{ .Nope"})
+	assert.Error(t, err)
+}
+
+func TestNotifierDefaultPayload(t *testing.T) {
+	n, ep, _ := newTestNotifier(t, &Destination{Name: "all"})
+	n.HandleEvent(exited("web_0"))
+
+	if assert.Len(t, ep.bodies, 1) {
+		var data map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(ep.bodies[0]), &data))
+		assert.Equal(t, "PROCESS_STATE_EXITED", data["event"])
+		assert.Equal(t, "web_0", data["process"])
+		assert.Equal(t, "1970-01-01T00:16:40Z", data["time"])
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	d := &Destination{Name: "flaky", Retries: 2, RetryDelay: time.Second}
+	n, ep, clock := newTestNotifier(t, d)
+	ep.statuses = []int{500, 502, 200, 500, 500, 500}
+
+	assert.NoError(t, n.Deliver(d, newData(exited("web_0"), clock.Now())))
+	assert.Len(t, ep.bodies, 3)
+	assert.Equal(t, time.Unix(1003, 0).UTC(), clock.Now())
+
+	assert.Error(t, n.Deliver(d, newData(exited("web_1"), clock.Now())))
+	assert.Len(t, ep.bodies, 6)
+}
+
+func TestNotifierDedupAndRateLimit(t *testing.T) {
+	d := &Destination{Name: "limited", Dedup: time.Minute, RateLimit: 2, RatePeriod: time.Minute}
+	n, ep, clock := newTestNotifier(t, d)
+
+	assert.NoError(t, n.Deliver(d, newData(exited("web_0"), clock.Now())))
+	assert.Equal(t, ErrDuplicate, n.Deliver(d, newData(exited("web_0"), clock.Now())))
+	assert.NoError(t, n.Deliver(d, newData(exited("web_1"), clock.Now())))
+	assert.Equal(t, ErrRateLimited, n.Deliver(d, newData(exited("web_2"), clock.Now())))
+	assert.Len(t, ep.bodies, 2)
+
+	clock.Sleep(time.Minute)
+	assert.NoError(t, n.Deliver(d, newData(exited("web_0"), clock.Now())))
+	assert.Len(t, ep.bodies, 3)
+}
+
+func TestNotifierDedupInFlight(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d := &Destination{Name: "slow", URL: server.URL, Dedup: time.Minute}
+	n := &Notifier{Destinations: []*Destination{d}, Logger: log.New(io.Discard, "", 0)}
+	data := newData(exited("web_0"), time.Unix(1000, 0))
+
+	done := make(chan error)
+	go func() { done <- n.Deliver(d, data) }()
+	<-arrived
+	assert.Equal(t, ErrDuplicate, n.Deliver(d, data))
+	close(release)
+	assert.Error(t, <-done)
+
+	//a failed delivery does not block the event
+	go func() { <-arrived }()
+	assert.NotEqual(t, ErrDuplicate, n.Deliver(d, data))
+}
+
+func TestNotifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//accepts the request, but doesn't answer
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	d := &Destination{Name: "hanging", URL: server.URL, Timeout: 50 * time.Millisecond, BreakerThreshold: 1, BreakerCooldown: time.Minute}
+	n := &Notifier{Destinations: []*Destination{d}, Logger: log.New(io.Discard, "", 0)}
+
+	start := time.Now()
+	err := n.Deliver(d, newData(exited("web_0"), time.Unix(1000, 0)))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, ErrCircuitOpen, n.Deliver(d, newData(exited("web_1"), time.Unix(1000, 0))))
+}
+
+func TestDestinationWithoutNewNotifier(t *testing.T) {
+	ep := &endpoint{}
+	server := httptest.NewServer(ep)
+	defer server.Close()
+
+	d := &Destination{Name: "literal", URL: server.URL, Template: `{"process": {{ .Process | json }}}`}
+	n := &Notifier{Destinations: []*Destination{d}}
+	assert.NoError(t, n.Deliver(d, newData(exited("web_0"), time.Unix(1000, 0))))
+	assert.Equal(t, []string{`{"process": "web_0"}`}, ep.bodies)
+
+	broken := &Destination{Name: "broken", URL: server.URL, Template: "{{ .Nope"}
+	assert.Error(t, n.Deliver(broken, newData(exited("web_0"), time.Unix(1000, 0))))
+	assert.Len(t, ep.bodies, 1)
+}
+
+func TestNotifierCircuitBreaker(t *testing.T) {
+	d := &Destination{Name: "down", BreakerThreshold: 2, BreakerCooldown: time.Minute}
+	n, ep, clock := newTestNotifier(t, d)
+	ep.statuses = []int{503, 503, 503, 200}
+
+	assert.Error(t, n.Deliver(d, newData(exited("a"), clock.Now())))
+	assert.Error(t, n.Deliver(d, newData(exited("b"), clock.Now())))
+	assert.Equal(t, ErrCircuitOpen, n.Deliver(d, newData(exited("c"), clock.Now())))
+	assert.Len(t, ep.bodies, 2)
+
+	//after the cooldown one failure opens the circuit again
+	clock.Sleep(time.Minute)
+	assert.Error(t, n.Deliver(d, newData(exited("d"), clock.Now())))
+	assert.Equal(t, ErrCircuitOpen, n.Deliver(d, newData(exited("e"), clock.Now())))
+
+	clock.Sleep(time.Minute)
+	assert.NoError(t, n.Deliver(d, newData(exited("f"), clock.Now())))
+	assert.NoError(t, n.Deliver(d, newData(exited("g"), clock.Now())))
+	assert.Len(t, ep.bodies, 5)
+}
@@ -10,3 +10,32 @@ const (
 	FATAL    int64 = 200
 	UNKNOWN  int64 = 1000
 )
+
+var names = map[int64]string{
+	STOPPED:  "STOPPED",
+	STARTING: "STARTING",
+	RUNNING:  "RUNNING",
+	BACKOFF:  "BACKOFF",
+	STOPPING: "STOPPING",
+	EXITED:   "EXITED",
+	FATAL:    "FATAL",
+	UNKNOWN:  "UNKNOWN",
+}
+
+// Name returns the name supervisor uses for a state code.
+func Name(code int64) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return names[UNKNOWN]
+}
+
+// Code returns the state code for a name such as RUNNING.
+func Code(name string) (int64, bool) {
+	for code, n := range names {
+		if n == name {
+			return code, true
+		}
+	}
+	return UNKNOWN, false
+}
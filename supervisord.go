@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Ligustah/xmlrpc"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -99,6 +100,7 @@ type Supervisor interface {
 	StopProcess(string, bool) (bool, error)
 	StopAllProcesses(bool) ([]ProcessInfo, error)
 	StopProcessGroup(string, bool) ([]ProcessInfo, error)
+	SignalProcess(string, string) (bool, error)
 	SendProcessStdin(string, string) (bool, error)
 	SendRemoteCommEvent(string, string) (bool, error)
 	AddProcessGroup(string) (bool, error)
@@ -159,7 +161,7 @@ func (s *supervisor) readProcessLog(source, name string, offset, length int64) (
 func (s *supervisor) tailProcessLog(source, name string, inOffset, length int64) (result string, offset int64, overflow bool, err error) {
 	var values []interface{}
 	if err = s.rpcClient.Call(fmt.Sprintf("supervisor.tailProcessStd%sLog", source),
-		xmlrpc.Params{[]interface{}{name, offset, length}}, &values); err != nil {
+		xmlrpc.Params{[]interface{}{name, inOffset, length}}, &values); err != nil {
 		return
 	}
 
@@ -321,6 +323,11 @@ func (s *supervisor) StopProcessGroup(name string, wait bool) ([]ProcessInfo, er
 	return s.multiProcessAction("stopProcessGroup", xmlrpc.Params{[]interface{}{name, wait}})
 }
 
+func (s *supervisor) SignalProcess(name, signal string) (success bool, err error) {
+	err = s.rpcClient.Call("supervisor.signalProcess", xmlrpc.Params{[]interface{}{name, signal}}, &success)
+	return
+}
+
 func (s *supervisor) SendProcessStdin(name, chars string) (success bool, err error) {
 	err = s.rpcClient.Call("supervisor.sendProcessStdin", xmlrpc.Params{[]interface{}{name, chars}}, &success)
 	return
@@ -384,23 +391,45 @@ func (st *supervisorTransport) RoundTrip(req *http.Request) (*http.Response, err
 	}
 
 	if req.URL.Scheme != "unix" {
-		panic("unix: unsupported protocol scheme")
+		return nil, fmt.Errorf("unix: unsupported protocol scheme %q", req.URL.Scheme)
 	}
 
 	sock, err := net.Dial("unix", req.URL.Path)
 	if err != nil {
 		return nil, err
 	}
-	defer sock.Close()
 
 	//create shallow copy of request object
 	newReq := new(http.Request)
 	*newReq = *req
 
 	newReq.URL = supervisorURL
-	newReq.Write(sock)
+	newReq.Host = supervisorURL.Host
+	if err = newReq.Write(sock); err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(sock), req)
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	//the socket is needed until the body has been read
+	resp.Body = &socketBody{resp.Body, sock}
+	return resp, nil
+}
+
+type socketBody struct {
+	io.ReadCloser
+	sock net.Conn
+}
 
-	return http.ReadResponse(bufio.NewReader(sock), req)
+func (b *socketBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.sock.Close()
+	return err
 }
 
 // New returns a Supervisor interface type connected to the net.URL specified in u